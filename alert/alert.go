@@ -0,0 +1,146 @@
+package alert
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/environment"
+	"github.com/jainmickey/justworks_integration/ses"
+	"github.com/jainmickey/justworks_integration/slacknotifier"
+	"github.com/jainmickey/justworks_integration/state"
+)
+
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Critical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "INFO"
+	case Warning:
+		return "WARNING"
+	}
+	return "CRITICAL"
+}
+
+// Alert is something an admin has to act on. Key identifies the underlying
+// problem so repeats of it can be suppressed.
+type Alert struct {
+	Key         string
+	Severity    Severity
+	Subject     string
+	Message     string
+	Remediation string
+}
+
+func (a Alert) Text() string {
+	text := fmt.Sprintf("[%s] %s\n\n%s", a.Severity, a.Subject, a.Message)
+	if len(a.Remediation) > 0 {
+		text = fmt.Sprintf("%s\n\nHow to fix: %s", text, a.Remediation)
+	}
+	return text
+}
+
+type Alerter interface {
+	Send(alert Alert) error
+}
+
+// ---------- Backends ----------------------------------------------------------
+
+type LogAlerter struct{}
+
+func (LogAlerter) Send(alert Alert) error {
+	log.Printf("alert: %s", alert.Text())
+	return nil
+}
+
+type EmailAlerter struct {
+	config environment.EmailConfig
+}
+
+func (ea EmailAlerter) Send(alert Alert) error {
+	subject := fmt.Sprintf("[%s] %s", alert.Severity, alert.Subject)
+	_, err := ses.SendEmailSMTP(ea.config.DefaultFrom, ea.config.AdminAddress, subject, alert.Text(), ea.config)
+	return err
+}
+
+type SlackAlerter struct {
+	slack slacknotifier.Slack
+}
+
+func (sa SlackAlerter) Send(alert Alert) error {
+	emoji := ":warning:"
+	if alert.Severity == Critical {
+		emoji = ":rotating_light:"
+	} else if alert.Severity == Info {
+		emoji = ":information_source:"
+	}
+	return sa.slack.Notify(fmt.Sprintf("%s %s", emoji, alert.Text()))
+}
+
+// MultiAlerter sends to every backend and returns the last error, if any.
+type MultiAlerter []Alerter
+
+func (ma MultiAlerter) Send(alert Alert) error {
+	var lastErr error
+	for _, alerter := range ma {
+		err := alerter.Send(alert)
+		if err != nil {
+			fmt.Println("Error in sending alert", alert.Key, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// ---------- Deduplication -----------------------------------------------------
+
+const sentAlertsKey = "alerts_sent"
+
+// DedupAlerter drops an alert if one with the same key went out within the
+// window, so an expired token alerts once a day rather than on every run.
+// The send times live in the state store and are saved with it.
+type DedupAlerter struct {
+	next   Alerter
+	store  *state.Store
+	window time.Duration
+}
+
+func (da DedupAlerter) Send(alert Alert) error {
+	sent := map[string]time.Time{}
+	da.store.Get(sentAlertsKey, &sent)
+	if last, ok := sent[alert.Key]; ok && time.Since(last) < da.window {
+		fmt.Println("Alert already sent, skipping", alert.Key, last)
+		return nil
+	}
+	err := da.next.Send(alert)
+	if err != nil {
+		return err
+	}
+	sent[alert.Key] = time.Now()
+	return da.store.Set(sentAlertsKey, sent)
+}
+
+// New logs every alert and, deduplicated, emails and posts it to the admin
+// Slack channel when those are configured.
+func New(config *environment.Config, store *state.Store) Alerter {
+	var backends MultiAlerter
+	if config.Email.Enabled {
+		backends = append(backends, EmailAlerter{config: config.Email})
+	}
+	if len(config.Alerts.AdminSlackWebhookURL) > 0 {
+		slackConn := slacknotifier.New(config.Alerts.AdminSlackWebhookURL.Value())
+		backends = append(backends, SlackAlerter{slack: slackConn})
+	}
+	window := time.Duration(config.Alerts.DedupHours) * time.Hour
+	return MultiAlerter{
+		LogAlerter{},
+		DedupAlerter{next: backends, store: store, window: window},
+	}
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jainmickey/justworks_integration/forecast"
+	"github.com/jainmickey/justworks_integration/state"
+	"github.com/jainmickey/justworks_integration/subscriptions"
+)
+
+// colleague finds someone's name and email from a Slack mention, a
+// Forecast name or an email.
+func (s *Server) colleague(who string, people []forecast.ForecastPerson) (string, string, error) {
+	notFound := fmt.Errorf("I couldn't find %s, try their @mention or email.", who)
+	if match := userMention.FindStringSubmatch(who); match != nil {
+		email, err := s.userEmail(match[1])
+		if err != nil || len(email) == 0 {
+			return "", "", notFound
+		}
+		for _, fp := range people {
+			if strings.EqualFold(fp.Email(), email) {
+				return fp.FullName(), email, nil
+			}
+		}
+		if name := strings.TrimPrefix(match[2], "|"); len(name) > 0 {
+			return name, email, nil
+		}
+		return email, email, nil
+	}
+	fp, found, err := personNamed(who, people)
+	if err != nil {
+		return "", "", err
+	}
+	if found {
+		return fp.FullName(), fp.Email(), nil
+	}
+	name := strings.ToLower(strings.TrimPrefix(who, "@"))
+	if strings.Contains(name, "@") {
+		return name, name, nil
+	}
+	return "", "", notFound
+}
+
+// personNamed finds someone by email, full name or a first name nobody
+// else has. A first name shared by several people is an error listing them.
+func personNamed(who string, people []forecast.ForecastPerson) (forecast.ForecastPerson, bool, error) {
+	name := strings.ToLower(strings.TrimPrefix(who, "@"))
+	var sameFirstName []forecast.ForecastPerson
+	for _, fp := range people {
+		if strings.EqualFold(fp.Email(), name) || strings.ToLower(fp.FullName()) == name {
+			return fp, true, nil
+		}
+		if strings.ToLower(fp.FirstName()) == name {
+			sameFirstName = append(sameFirstName, fp)
+		}
+	}
+	if len(sameFirstName) == 1 {
+		return sameFirstName[0], true, nil
+	}
+	if len(sameFirstName) > 1 {
+		var names []string
+		for _, fp := range sameFirstName {
+			names = append(names, fp.FullName())
+		}
+		return forecast.ForecastPerson{}, false, fmt.Errorf("There's more than one %s: %s. Which one? Use their @mention or email.", who, strings.Join(names, ", "))
+	}
+	return forecast.ForecastPerson{}, false, nil
+}
+
+// follow handles "/ooo follow <who> [as <label>]".
+func (s *Server) follow(userID string, text string, people []forecast.ForecastPerson) string {
+	if !s.config.Subscriptions.Enabled {
+		return "Following colleagues isn't turned on, ask an admin to set SubscriptionsEnabled."
+	}
+	who, label := text, ""
+	if i := strings.Index(strings.ToLower(text), " as "); i >= 0 {
+		who, label = strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+len(" as "):])
+	}
+	name, email, err := s.colleague(who, people)
+	if err != nil {
+		return err.Error()
+	}
+	err = s.updateState(func(store *state.Store) error {
+		if err := subscriptions.AddFollow(store, userID, subscriptions.Follow{Email: email, Name: name, Label: label}); err != nil {
+			return err
+		}
+		preferences := subscriptions.Get(store, userID)
+		if len(preferences.Email) == 0 {
+			preferences.Email, _ = s.userEmail(userID)
+			return subscriptions.Set(store, userID, preferences)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Error in saving follow", userID, err)
+		return "Sorry, I couldn't save that, please try again."
+	}
+	return fmt.Sprintf("Done, I'll send you a direct message when %s books or starts PTO.", name)
+}
+
+func (s *Server) unfollow(userID string, who string, people []forecast.ForecastPerson) string {
+	name, email, err := s.colleague(who, people)
+	if err != nil {
+		return err.Error()
+	}
+	removed := false
+	err = s.updateState(func(store *state.Store) error {
+		var err error
+		removed, err = subscriptions.RemoveFollow(store, userID, email)
+		return err
+	})
+	if err != nil {
+		fmt.Println("Error in saving follow", userID, err)
+		return "Sorry, I couldn't save that, please try again."
+	}
+	if !removed {
+		return fmt.Sprintf("You weren't following %s.", name)
+	}
+	return fmt.Sprintf("Done, you've unfollowed %s.", name)
+}
+
+func (s *Server) following(userID string) string {
+	var follows []subscriptions.Follow
+	err := s.readState(func(store *state.Store) {
+		follows = subscriptions.Get(store, userID).Following
+	})
+	if err != nil {
+		fmt.Println("Error in reading follows", userID, err)
+		return "Sorry, I couldn't read your follows, please try again."
+	}
+	if len(follows) == 0 {
+		return "You're not following anyone, try `/ooo follow @nathan as pair`."
+	}
+	lines := []string{"*You're following*:"}
+	for _, follow := range follows {
+		line := fmt.Sprintf("- %s", follow.Name)
+		if len(follow.Label) > 0 {
+			line = fmt.Sprintf("%s, your %s", line, follow.Label)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
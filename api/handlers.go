@@ -0,0 +1,236 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/feeds"
+	"github.com/jainmickey/justworks_integration/forecast"
+	"github.com/jainmickey/justworks_integration/justworks"
+	"github.com/jainmickey/justworks_integration/workcal"
+)
+
+const dateLayout = "2006-01-02"
+
+// Event is what the API returns for a Justworks event.
+type Event struct {
+	UID     string    `json:"uid"`
+	Name    string    `json:"name"`
+	Type    string    `json:"type"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	LastDay string    `json:"last_day"`
+	Partial bool      `json:"partial"`
+	Hours   float64   `json:"hours_per_day"`
+	Status  string    `json:"status"`
+	Emails  []string  `json:"emails"`
+}
+
+func toEvent(ev justworks.Event) Event {
+	return Event{
+		UID:     ev.UID(),
+		Name:    ev.Name(),
+		Type:    ev.DisplayType(),
+		Start:   ev.StartDate(),
+		End:     ev.EndDate(),
+		LastDay: ev.LastDay().Format(dateLayout),
+		Partial: ev.IsPartialDay(),
+		Hours:   ev.HoursPerDay(),
+		Status:  ev.Status(),
+		Emails:  ev.Emails(),
+	}
+}
+
+func toEvents(events []justworks.Event) []Event {
+	list := []Event{}
+	for _, ev := range events {
+		list = append(list, toEvent(ev))
+	}
+	return list
+}
+
+// dateRange reads ?from= and ?to= (both included), defaulting to the given
+// range.
+func dateRange(r *http.Request, from time.Time, to time.Time) (time.Time, time.Time, error) {
+	for name, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		value := r.URL.Query().Get(name)
+		if len(value) == 0 {
+			continue
+		}
+		date, err := time.Parse(dateLayout, value)
+		if err != nil {
+			return from, to, fmt.Errorf("%s must look like %s", name, dateLayout)
+		}
+		*target = date
+	}
+	return from, to, nil
+}
+
+func overlapping(events []justworks.Event, from time.Time, to time.Time) []justworks.Event {
+	var list []justworks.Event
+	for _, ev := range events {
+		if ev.IsCancelled() || ev.IsTentative() {
+			continue
+		}
+		if ev.StartDate().Before(to.AddDate(0, 0, 1)) && !ev.LastDay().Before(from) {
+			list = append(list, ev)
+		}
+	}
+	return list
+}
+
+// teamEvents narrows events to a team, with the same teams as the calendar
+// feeds, or else the people with a Forecast role of that name.
+func (s *Server) teamEvents(team string, events []justworks.Event, people []forecast.ForecastPerson) ([]justworks.Event, bool) {
+	if len(team) == 0 {
+		return events, true
+	}
+	for _, feed := range feeds.BuildFeeds(people, events, s.config.Feeds) {
+		if strings.EqualFold(feed.Name, team) {
+			return feed.Events, true
+		}
+	}
+	var roleEvents []justworks.Event
+	found := false
+	for _, fp := range people {
+		for _, role := range fp.RoleNames() {
+			if strings.EqualFold(role, team) {
+				roleEvents = append(roleEvents, forecast.EventsForPerson(fp, events)...)
+				found = true
+				break
+			}
+		}
+	}
+	return roleEvents, found
+}
+
+// GET /events?from=&to=&type=&team=
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	events, people := s.snapshot()
+	today := workcal.Day(time.Now())
+	from, to, err := dateRange(r, today, today.AddDate(0, 0, 30))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	events = overlapping(events, from, to)
+	events, ok := s.teamEvents(r.URL.Query().Get("team"), events, people)
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown team")
+		return
+	}
+	if eventType := r.URL.Query().Get("type"); len(eventType) > 0 {
+		var ofType []justworks.Event
+		for _, ev := range events {
+			if strings.EqualFold(ev.DisplayType(), eventType) || strings.EqualFold(ev.EventType(), eventType) {
+				ofType = append(ofType, ev)
+			}
+		}
+		events = ofType
+	}
+	writeJSON(w, http.StatusOK, toEvents(events))
+}
+
+// GET /today
+func (s *Server) handleToday(w http.ResponseWriter, r *http.Request) {
+	events, _ := s.snapshot()
+	today := workcal.Day(time.Now())
+	writeJSON(w, http.StatusOK, toEvents(overlapping(events, today, today)))
+}
+
+// GET /people/{email}/pto?from=&to=
+func (s *Server) handlePersonPTO(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/people/"), "/"), "/")
+	if len(parts) != 2 || parts[1] != "pto" || len(parts[0]) == 0 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	email := parts[0]
+	events, people := s.snapshot()
+	today := workcal.Day(time.Now())
+	from, to, err := dateRange(r, time.Date(today.Year(), 1, 1, 0, 0, 0, 0, time.UTC), time.Date(today.Year(), 12, 31, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var personEvents []justworks.Event
+	for _, fp := range people {
+		if strings.EqualFold(fp.Email(), email) {
+			personEvents = forecast.EventsForPerson(fp, events)
+		}
+	}
+	if len(people) == 0 {
+		for _, ev := range events {
+			if ev.HasEmail(email) {
+				personEvents = append(personEvents, ev)
+			}
+		}
+	}
+	var pto []justworks.Event
+	for _, ev := range overlapping(personEvents, from, to) {
+		if ev.IsAbsence(true) {
+			pto = append(pto, ev)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"email": email, "pto": toEvents(pto)})
+}
+
+// todayAndUpcoming splits vacation and remote events like the daily digest.
+func todayAndUpcoming(events []justworks.Event) ([]justworks.Event, []justworks.Event) {
+	events, _ = justworks.FilterEventsForVacationAndRemote(events)
+	today := workcal.Day(time.Now())
+	upcomingStart, upcomingEnd := justworks.UpcomingDateRange()
+	todaysEvents := overlapping(events, today, today)
+	var upcomingEvents []justworks.Event
+	for _, ev := range events {
+		if !ev.StartDate().Before(upcomingStart) && ev.StartDate().Before(upcomingEnd) {
+			upcomingEvents = append(upcomingEvents, ev)
+		}
+	}
+	return todaysEvents, upcomingEvents
+}
+
+// teamDigest renders a team's day like the morning digest.
+func (s *Server) teamDigest(team string, todaysEvents []justworks.Event, upcomingEvents []justworks.Event, people []forecast.ForecastPerson) string {
+	calendarFor := forecast.CalendarForEvents(people, s.config.Holidays, s.calendar)
+	sortedEventsList, _ := justworks.SortCalenderItems(todaysEvents, false, false)
+	upcomingSortedEventsList, _ := justworks.SortCalenderItems(upcomingEvents, false, true)
+	message, _ := justworks.CreateTeamMessage(team, team, sortedEventsList, false, calendarFor)
+	upcomingMessage, _ := justworks.CreateTeamMessage(team, team, upcomingSortedEventsList, true, calendarFor)
+	return fmt.Sprintf("%s\n\n%s", message, upcomingMessage)
+}
+
+var slackMarkup = regexp.MustCompile(`:[a-z_][a-z0-9_+\-]*:\s?|\*`)
+
+// GET /digest/{team}?format=slack|text|json
+func (s *Server) handleDigest(w http.ResponseWriter, r *http.Request) {
+	team := strings.Trim(strings.TrimPrefix(r.URL.Path, "/digest/"), "/")
+	events, people := s.snapshot()
+	events, ok := s.teamEvents(team, events, people)
+	if !ok || len(team) == 0 {
+		writeError(w, http.StatusNotFound, "unknown team")
+		return
+	}
+	todaysEvents, upcomingEvents := todayAndUpcoming(events)
+
+	format := r.URL.Query().Get("format")
+	if format == "json" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"team": team, "today": toEvents(todaysEvents), "upcoming": toEvents(upcomingEvents)})
+		return
+	}
+	if format != "" && format != "slack" && format != "text" {
+		writeError(w, http.StatusBadRequest, "format must be slack, text or json")
+		return
+	}
+
+	digest := s.teamDigest(team, todaysEvents, upcomingEvents, people)
+	if format == "text" {
+		digest = slackMarkup.ReplaceAllString(digest, "")
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, digest)
+}
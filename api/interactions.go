@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/forecast"
+	"github.com/jainmickey/justworks_integration/slacknotifier"
+	"github.com/jainmickey/justworks_integration/state"
+	"github.com/jainmickey/justworks_integration/subscriptions"
+	"github.com/jainmickey/justworks_integration/workcal"
+)
+
+// interaction is the part of Slack's block_actions payload the bot reads.
+type interaction struct {
+	Type string `json:"type"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	ResponseURL string `json:"response_url"`
+	Actions     []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+}
+
+// POST /slack/interactions, verified with the Slack signing secret. Slack
+// wants an answer within three seconds, so the reply goes to the
+// response_url once it's ready.
+func (s *Server) handleInteraction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "only POST is supported")
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSlackBody))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "can't read body")
+		return
+	}
+	if err := slacknotifier.VerifyRequest(r.Header, body, s.config.Slack.SigningSecret.Value(), time.Now()); err != nil {
+		fmt.Println("Rejected Slack request", err)
+		writeError(w, http.StatusUnauthorized, "invalid signature")
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad form")
+		return
+	}
+	var payload interaction
+	if err := json.Unmarshal([]byte(form.Get("payload")), &payload); err != nil || payload.Type != "block_actions" || len(payload.Actions) == 0 {
+		writeError(w, http.StatusBadRequest, "unsupported payload")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	go func() {
+		text := s.runAction(payload.Actions[0].ActionID, payload.User.ID)
+		reply := slacknotifier.Message{Text: text, ResponseType: "ephemeral"}
+		if err := slacknotifier.Respond(payload.ResponseURL, reply); err != nil {
+			fmt.Println("Error in answering Slack interaction", err)
+		}
+	}()
+}
+
+func (s *Server) runAction(actionID string, userID string) string {
+	events, people := s.snapshot()
+	switch actionID {
+	case subscriptions.ShowFullWeekAction:
+		today := workcal.Day(time.Now())
+		return s.week(events, today.AddDate(0, 0, -((int(today.Weekday())+6)%7)), "this week")
+	case subscriptions.OnlyMyTeamAction:
+		return s.myTeamDigest(userID, people)
+	case subscriptions.SubscribeAction, subscriptions.UnsubscribeAction:
+		return s.setDigestDM(userID, actionID == subscriptions.SubscribeAction)
+	}
+	return fmt.Sprintf("I don't know the action %s.", actionID)
+}
+
+// userEmail needs the bot token, Slack doesn't send emails with actions.
+func (s *Server) userEmail(userID string) (string, error) {
+	if len(s.config.Slack.BotToken) == 0 {
+		return "", fmt.Errorf("SlackBotToken isn't set")
+	}
+	return slacknotifier.NewClient(s.config.Slack.BotToken.Value()).UserEmail(userID)
+}
+
+// teamFor is the first configured feed team with one of the person's
+// roles, or else their first Forecast role.
+func (s *Server) teamFor(fp forecast.ForecastPerson) string {
+	var names []string
+	for name := range s.config.Feeds.Teams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, wanted := range strings.Split(s.config.Feeds.Teams[name], "|") {
+			for _, role := range fp.RoleNames() {
+				if strings.EqualFold(role, strings.TrimSpace(wanted)) {
+					return name
+				}
+			}
+		}
+	}
+	if roles := fp.RoleNames(); len(roles) > 0 {
+		return roles[0]
+	}
+	return ""
+}
+
+func (s *Server) myTeamDigest(userID string, people []forecast.ForecastPerson) string {
+	email, err := s.userEmail(userID)
+	if err != nil {
+		fmt.Println("Error in finding Slack user", userID, err)
+		return "I couldn't find your email in Slack."
+	}
+	team := ""
+	for _, fp := range people {
+		if strings.EqualFold(fp.Email(), email) {
+			team = s.teamFor(fp)
+		}
+	}
+	if len(team) == 0 {
+		return "I couldn't find your team in Forecast."
+	}
+	events, _ := s.snapshot()
+	teamEvents, _ := s.teamEvents(team, events, people)
+	todaysEvents, upcomingEvents := todayAndUpcoming(teamEvents)
+	return s.teamDigest(team, todaysEvents, upcomingEvents, people)
+}
+
+func (s *Server) setDigestDM(userID string, subscribe bool) string {
+	if subscribe && len(s.config.Slack.BotToken) == 0 {
+		return "Direct messages need a Slack bot token, ask an admin to set one up."
+	}
+	err := s.updateState(func(store *state.Store) error {
+		preferences := subscriptions.Get(store, userID)
+		preferences.DigestDM = subscribe
+		if subscribe && len(preferences.Email) == 0 {
+			preferences.Email, _ = s.userEmail(userID)
+		}
+		return subscriptions.Set(store, userID, preferences)
+	})
+	if err != nil {
+		fmt.Println("Error in saving preferences", userID, err)
+		return "Sorry, I couldn't save that, please try again."
+	}
+	if subscribe {
+		return "Done, you'll get the digest as a direct message every morning."
+	}
+	return "Done, no more digest direct messages."
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/alert"
+	"github.com/jainmickey/justworks_integration/environment"
+	"github.com/jainmickey/justworks_integration/forecast"
+	"github.com/jainmickey/justworks_integration/holidays"
+	"github.com/jainmickey/justworks_integration/justworks"
+	"github.com/jainmickey/justworks_integration/state"
+)
+
+// Server answers from a cache of the parsed Justworks calendar and the
+// Forecast people, refreshed every RefreshMinutes.
+type Server struct {
+	config   *environment.Config
+	store    *state.Store
+	alerter  alert.Alerter
+	calendar *holidays.Calendar
+
+	// stateMutex serialises state store access, the store is reloaded
+	// before each change since the Lambda writes it too.
+	stateMutex sync.Mutex
+
+	mutex     sync.RWMutex
+	events    []justworks.Event
+	people    []forecast.ForecastPerson
+	refreshed time.Time
+}
+
+func New(config *environment.Config, store *state.Store, alerter alert.Alerter, calendar *holidays.Calendar) *Server {
+	return &Server{config: config, store: store, alerter: alerter, calendar: calendar}
+}
+
+// Refresh downloads the Justworks calendar and reloads the cache. The old
+// cache is kept when the download fails. Only the swap is locked, requests
+// never read the calendar file. The alerter keeps its send times in the
+// store, so everything that can alert runs inside updateState.
+func (s *Server) Refresh() error {
+	var people []forecast.ForecastPerson
+	var downloadErr error
+	err := s.updateState(func(store *state.Store) error {
+		justworksFileStatus, err := justworks.DownloadJustWorksFile(s.config, store, s.alerter)
+		if justworksFileStatus == false {
+			downloadErr = fmt.Errorf("Error in fetching justworks file: %s", err)
+			return nil
+		}
+		if s.config.Forecast.Enabled {
+			people, _ = forecast.GetPeopleDetailsFromForecast(s.config, s.alerter)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if downloadErr != nil {
+		return downloadErr
+	}
+	events, err := justworks.GetOverlapping(time.Time{}, time.Now().AddDate(10, 0, 0), s.config)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.events = events
+	s.people = people
+	s.refreshed = time.Now()
+	fmt.Println("Refreshed cache", len(s.events), "events", len(s.people), "people")
+	return nil
+}
+
+// updateState reloads the state store, applies change and saves it. Nothing
+// is saved when the reload fails, so a bad download can't wipe the state.
+func (s *Server) updateState(change func(store *state.Store) error) error {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	if err := s.store.Reload(); err != nil {
+		return err
+	}
+	if err := change(s.store); err != nil {
+		return err
+	}
+	return s.store.Save()
+}
+
+// readState reloads the state store for read.
+func (s *Server) readState(read func(store *state.Store)) error {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	if err := s.store.Reload(); err != nil {
+		return err
+	}
+	read(s.store)
+	return nil
+}
+
+func (s *Server) snapshot() ([]justworks.Event, []forecast.ForecastPerson) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.events, s.people
+}
+
+func (s *Server) refreshLoop() {
+	ticker := time.NewTicker(time.Duration(s.config.Server.RefreshMinutes) * time.Minute)
+	for range ticker.C {
+		if err := s.Refresh(); err != nil {
+			fmt.Println("Error in refreshing cache", err)
+		}
+	}
+}
+
+// authorized accepts "Authorization: Bearer <key>" or "X-API-Key: <key>".
+func (s *Server) authorized(r *http.Request) bool {
+	key := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		key = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if len(key) == 0 {
+		return false
+	}
+	for _, valid := range s.config.Server.Keys() {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(valid)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) requireKey(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r) {
+			writeError(w, http.StatusUnauthorized, "missing or invalid API key")
+			return
+		}
+		if r.Method != "GET" {
+			writeError(w, http.StatusMethodNotAllowed, "only GET is supported")
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.RLock()
+		defer s.mutex.RUnlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"refreshed": s.refreshed, "events": len(s.events)})
+	})
+	mux.HandleFunc("/events", s.requireKey(s.handleEvents))
+	mux.HandleFunc("/today", s.requireKey(s.handleToday))
+	mux.HandleFunc("/people/", s.requireKey(s.handlePersonPTO))
+	mux.HandleFunc("/digest/", s.requireKey(s.handleDigest))
+	mux.HandleFunc("/slack/commands", s.handleSlashCommand)
+	mux.HandleFunc("/slack/interactions", s.handleInteraction)
+	return mux
+}
+
+// ListenAndServe fills the cache, keeps it fresh and serves the API.
+func (s *Server) ListenAndServe() error {
+	if len(s.config.Server.Keys()) == 0 && len(s.config.Slack.SigningSecret) == 0 {
+		return fmt.Errorf("ServerAPIKeys or SlackSigningSecret must be set to run the API server")
+	}
+	if err := s.Refresh(); err != nil {
+		return err
+	}
+	go s.refreshLoop()
+	fmt.Println("Listening on", s.config.Server.Addr)
+	server := &http.Server{
+		Addr:              s.config.Server.Addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+	return server.ListenAndServe()
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/forecast"
+	"github.com/jainmickey/justworks_integration/justworks"
+	"github.com/jainmickey/justworks_integration/slacknotifier"
+	"github.com/jainmickey/justworks_integration/workcal"
+)
+
+const slashHelp = "Usage:\n" +
+	"- `/ooo` or `/ooo today`: who's out today and coming up\n" +
+	"- `/ooo next week`: who's out next week\n" +
+	"- `/ooo @rachel`: someone's upcoming time off\n" +
+	"- `/ooo team accounts`: a team's digest\n" +
+	"- `/ooo follow @nathan as pair`: a DM when they book or start PTO\n" +
+	"- `/ooo unfollow @nathan`, `/ooo following`: manage who you follow"
+
+// maxSlackBody caps what's read before the signature is checked, Slack's
+// payloads are a few KB.
+const maxSlackBody = 64 << 10
+
+var userMention = regexp.MustCompile(`^<@([A-Z0-9]+)(\|[^>]*)?>$`)
+
+// POST /slack/commands, verified with the Slack signing secret instead of
+// an API key. Following someone reads and saves the state file and asks
+// Slack for emails, which can take longer than Slack's three seconds, so
+// like interactions the answer goes to the response_url.
+func (s *Server) handleSlashCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "only POST is supported")
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSlackBody))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "can't read body")
+		return
+	}
+	if err := slacknotifier.VerifyRequest(r.Header, body, s.config.Slack.SigningSecret.Value(), time.Now()); err != nil {
+		fmt.Println("Rejected Slack request", err)
+		writeError(w, http.StatusUnauthorized, "invalid signature")
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad form")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	go func() {
+		text := s.runSlashCommand(strings.TrimSpace(form.Get("text")), form.Get("user_id"))
+		reply := slacknotifier.Message{Text: text, ResponseType: "ephemeral"}
+		if err := slacknotifier.Respond(form.Get("response_url"), reply); err != nil {
+			fmt.Println("Error in answering Slack command", err)
+		}
+	}()
+}
+
+func (s *Server) runSlashCommand(text string, userID string) string {
+	events, people := s.snapshot()
+	lower := strings.ToLower(text)
+	switch {
+	case lower == "" || lower == "today":
+		todaysEvents, upcomingEvents := todayAndUpcoming(events)
+		return s.teamDigest("everyone", todaysEvents, upcomingEvents, people)
+	case lower == "next week":
+		return s.nextWeek(events)
+	case lower == "help":
+		return slashHelp
+	case strings.HasPrefix(lower, "team "):
+		team := strings.TrimSpace(text[len("team "):])
+		teamEvents, ok := s.teamEvents(team, events, people)
+		if !ok {
+			return fmt.Sprintf("I don't know a team called %s.\n\n%s", team, slashHelp)
+		}
+		todaysEvents, upcomingEvents := todayAndUpcoming(teamEvents)
+		return s.teamDigest(team, todaysEvents, upcomingEvents, people)
+	case lower == "following":
+		return s.following(userID)
+	case strings.HasPrefix(lower, "follow "):
+		return s.follow(userID, strings.TrimSpace(text[len("follow "):]), people)
+	case strings.HasPrefix(lower, "unfollow "):
+		return s.unfollow(userID, strings.TrimSpace(text[len("unfollow "):]), people)
+	}
+	return s.personTimeOff(text, events, people)
+}
+
+// nextWeek is the weekly message for Monday to Sunday after today.
+func (s *Server) nextWeek(events []justworks.Event) string {
+	today := workcal.Day(time.Now())
+	start := today.AddDate(0, 0, 7-(int(today.Weekday())+6)%7)
+	return s.week(events, start, fmt.Sprintf("the week of %s", start.Format("Mon 2 Jan")))
+}
+
+// week is the weekly message for the seven days from start.
+func (s *Server) week(events []justworks.Event, start time.Time, title string) string {
+	weekEvents, _ := justworks.FilterEventsForVacationAndRemote(overlapping(events, start, start.AddDate(0, 0, 6)))
+	sortedEventsList, _ := justworks.SortCalenderItems(weekEvents, false, false)
+	message, _ := justworks.CreateEventMessage(sortedEventsList, workcal.Default(s.config.Holidays.DigestOffice, s.calendar))
+	return strings.Replace(message, "this week", title, 1)
+}
+
+// personEvents finds someone from a Slack mention (through their email
+// when there's a bot token) or from their name, see personNamed.
+func (s *Server) personEvents(who string, events []justworks.Event, people []forecast.ForecastPerson) (string, []justworks.Event, error) {
+	if match := userMention.FindStringSubmatch(who); match != nil {
+		if len(s.config.Slack.BotToken) > 0 {
+			client := slacknotifier.NewClient(s.config.Slack.BotToken.Value())
+			if email, err := client.UserEmail(match[1]); err == nil && len(email) > 0 {
+				for _, fp := range people {
+					if strings.EqualFold(fp.Email(), email) {
+						return fp.FullName(), forecast.EventsForPerson(fp, events), nil
+					}
+				}
+				var found []justworks.Event
+				for _, ev := range events {
+					if ev.HasEmail(email) {
+						found = append(found, ev)
+					}
+				}
+				return email, found, nil
+			}
+		}
+		who = strings.TrimPrefix(match[2], "|")
+	}
+
+	name := strings.ToLower(strings.TrimPrefix(who, "@"))
+	if len(name) == 0 {
+		return who, nil, nil
+	}
+	fp, ok, err := personNamed(who, people)
+	if err != nil {
+		return who, nil, err
+	}
+	if ok {
+		return fp.FullName(), forecast.EventsForPerson(fp, events), nil
+	}
+	var found []justworks.Event
+	for _, ev := range events {
+		if strings.HasPrefix(strings.ToLower(ev.Name()), name) {
+			found = append(found, ev)
+		}
+	}
+	return who, found, nil
+}
+
+func (s *Server) personTimeOff(who string, events []justworks.Event, people []forecast.ForecastPerson) string {
+	name, personEvents, err := s.personEvents(who, events, people)
+	if err != nil {
+		return err.Error()
+	}
+	today := workcal.Day(time.Now())
+	personEvents, _ = justworks.FilterEventsForVacationAndRemote(overlapping(personEvents, today, today.AddDate(0, 3, 0)))
+	if len(personEvents) == 0 {
+		return fmt.Sprintf("No time off coming up for %s.", name)
+	}
+	calendarFor := forecast.CalendarForEvents(people, s.config.Holidays, s.calendar)
+	sortedEventsList, _ := justworks.SortCalenderItems(personEvents, false, true)
+	message, _ := justworks.CreateTeamMessage(name, name, sortedEventsList, true, calendarFor)
+	return message
+}
@@ -0,0 +1,256 @@
+package capacity
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/environment"
+	"github.com/jainmickey/justworks_integration/forecast"
+	"github.com/jainmickey/justworks_integration/holidays"
+	"github.com/jainmickey/justworks_integration/justworks"
+	"github.com/jainmickey/justworks_integration/workcal"
+)
+
+const (
+	ByDay  = "day"
+	ByWeek = "week"
+)
+
+// Member is one person with the teams they count towards, their working
+// calendar and their Justworks events.
+type Member struct {
+	Name     string
+	Teams    []string
+	Calendar workcal.Calendar
+	Events   []justworks.Event
+}
+
+// Cell is a team's capacity over one period, in person-days.
+type Cell struct {
+	Team      string
+	Period    time.Time
+	Scheduled float64
+	Out       float64
+	People    int
+}
+
+func (c Cell) OutPercent() float64 {
+	if c.Scheduled == 0 {
+		return 0
+	}
+	return 100 * c.Out / c.Scheduled
+}
+
+func (c Cell) AvailablePercent() float64 {
+	return 100 - c.OutPercent()
+}
+
+// Report holds the capacity of every team per period between From and To
+// (To not included). Days is always per day, it's where the flagged days
+// come from.
+type Report struct {
+	From      time.Time
+	To        time.Time
+	By        string
+	Threshold int
+	Teams     []string
+	Periods   []time.Time
+	Cells     []Cell
+	Days      []Cell
+}
+
+func weekOf(date time.Time) time.Time {
+	offset := (int(date.Weekday()) + 6) % 7
+	return workcal.Day(date).AddDate(0, 0, -offset)
+}
+
+// OutOn is how much of date a member is away, 1 for a full day.
+func (m Member) OutOn(date time.Time) float64 {
+	return justworks.OutOn(m.Events, date)
+}
+
+// Members turns the active Forecast people into capacity members, one team
+// per role, with their Justworks events attached.
+func Members(forecastPeople []forecast.ForecastPerson, events []justworks.Event, config environment.HolidaysConfig, calendar *holidays.Calendar) []Member {
+	var members []Member
+	for _, fp := range forecastPeople {
+		if !fp.IsActive() {
+			continue
+		}
+		member := Member{
+			Name:     fp.FullName(),
+			Teams:    fp.RoleNames(),
+			Calendar: forecast.WorkingCalendar(fp, config, calendar),
+		}
+		if len(member.Teams) == 0 {
+			member.Teams = []string{"No role"}
+		}
+		member.Events = forecast.EventsForPerson(fp, events)
+		members = append(members, member)
+	}
+	return members
+}
+
+func buildCells(members []Member, from time.Time, to time.Time, periodOf func(time.Time) time.Time) ([]Cell, []time.Time) {
+	cells := map[string]map[time.Time]*Cell{}
+	var periods []time.Time
+	seen := map[time.Time]bool{}
+	for date := workcal.Day(from); date.Before(to); date = date.AddDate(0, 0, 1) {
+		period := periodOf(date)
+		if !seen[period] {
+			seen[period] = true
+			periods = append(periods, period)
+		}
+		for _, m := range members {
+			if !m.Calendar.IsWorkingDay(date) {
+				continue
+			}
+			out := m.OutOn(date)
+			for _, team := range m.Teams {
+				if _, ok := cells[team]; !ok {
+					cells[team] = map[time.Time]*Cell{}
+				}
+				cell, ok := cells[team][period]
+				if !ok {
+					cell = &Cell{Team: team, Period: period}
+					cells[team][period] = cell
+				}
+				cell.Scheduled++
+				cell.Out += out
+			}
+		}
+	}
+
+	var list []Cell
+	for team := range cells {
+		for _, period := range periods {
+			if cell, ok := cells[team][period]; ok {
+				list = append(list, *cell)
+			}
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Team != list[j].Team {
+			return list[i].Team < list[j].Team
+		}
+		return list[i].Period.Before(list[j].Period)
+	})
+	return list, periods
+}
+
+func teamSizes(members []Member) map[string]int {
+	sizes := map[string]int{}
+	for _, m := range members {
+		for _, team := range m.Teams {
+			sizes[team]++
+		}
+	}
+	return sizes
+}
+
+// Build works out each team's availability per day or week. Days off and
+// office holidays aren't scheduled, so they don't lower availability.
+func Build(members []Member, from time.Time, to time.Time, by string, threshold int) Report {
+	report := Report{From: from, To: to, By: by, Threshold: threshold}
+	sizes := teamSizes(members)
+	for team := range sizes {
+		report.Teams = append(report.Teams, team)
+	}
+	sort.Strings(report.Teams)
+
+	report.Days, report.Periods = buildCells(members, from, to, workcal.Day)
+	if by == ByWeek {
+		report.Cells, report.Periods = buildCells(members, from, to, weekOf)
+	} else {
+		report.Cells = report.Days
+	}
+	for _, cells := range [][]Cell{report.Days, report.Cells} {
+		for i := range cells {
+			cells[i].People = sizes[cells[i].Team]
+		}
+	}
+	return report
+}
+
+// Flagged are the days where more than Threshold percent of a team is out.
+func (r Report) Flagged() []Cell {
+	var flagged []Cell
+	for _, cell := range r.Days {
+		if cell.Scheduled > 0 && cell.OutPercent() > float64(r.Threshold) {
+			flagged = append(flagged, cell)
+		}
+	}
+	sort.SliceStable(flagged, func(i, j int) bool {
+		return flagged[i].Period.Before(flagged[j].Period)
+	})
+	return flagged
+}
+
+func (r Report) isFlagged(cell Cell) bool {
+	for _, flagged := range r.Flagged() {
+		if flagged.Team != cell.Team {
+			continue
+		}
+		if flagged.Period.Equal(cell.Period) || (r.By == ByWeek && weekOf(flagged.Period).Equal(cell.Period)) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatNumber(value float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", value), "0"), ".")
+}
+
+func (r Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"team", r.By, "people", "scheduled_days", "out_days", "available_percent", "flagged"})
+	for _, cell := range r.Cells {
+		writer.Write([]string{
+			cell.Team,
+			cell.Period.Format("2006-01-02"),
+			fmt.Sprintf("%d", cell.People),
+			formatNumber(cell.Scheduled),
+			formatNumber(cell.Out),
+			fmt.Sprintf("%.0f", cell.AvailablePercent()),
+			fmt.Sprintf("%t", r.isFlagged(cell)),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// SlackSummary lists the flagged days first, then the average availability
+// of each team over the whole range.
+func (r Report) SlackSummary() string {
+	messaging := fmt.Sprintf(":busts_in_silhouette: *Team availability %s – %s*:\n\n",
+		r.From.Format("2 Jan 2006"), r.To.AddDate(0, 0, -1).Format("2 Jan 2006"))
+
+	flagged := r.Flagged()
+	if len(flagged) == 0 {
+		messaging = fmt.Sprintf("%sNo day has more than %d%% of a team out.\n", messaging, r.Threshold)
+	} else {
+		messaging = fmt.Sprintf("%s:warning: *Low availability* (more than %d%% out):\n", messaging, r.Threshold)
+		for _, cell := range flagged {
+			messaging = fmt.Sprintf("%s- %s: %s %.0f%% out (%s of %d)\n", messaging,
+				cell.Period.Format("Mon, 2 Jan"), cell.Team, cell.OutPercent(), formatNumber(cell.Out), cell.People)
+		}
+	}
+
+	scheduled := map[string]float64{}
+	out := map[string]float64{}
+	for _, cell := range r.Days {
+		scheduled[cell.Team] += cell.Scheduled
+		out[cell.Team] += cell.Out
+	}
+	messaging = fmt.Sprintf("%s\n*Average availability*:\n", messaging)
+	for _, team := range r.Teams {
+		cell := Cell{Scheduled: scheduled[team], Out: out[team]}
+		messaging = fmt.Sprintf("%s- %s: %.0f%%\n", messaging, team, cell.AvailablePercent())
+	}
+	return messaging
+}
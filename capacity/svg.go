@@ -0,0 +1,80 @@
+package capacity
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+const (
+	cellWidth    = 34
+	cellHeight   = 22
+	labelWidth   = 150
+	headerHeight = 40
+)
+
+// cellColor goes from red at 50% available or less to green at 100%.
+func cellColor(available float64) string {
+	scaled := (available - 50) / 50
+	if scaled < 0 {
+		scaled = 0
+	}
+	if scaled > 1 {
+		scaled = 1
+	}
+	return fmt.Sprintf("hsl(%.0f, 70%%, 55%%)", scaled*120)
+}
+
+// WriteSVG draws the report as a heatmap, one row per team and one column
+// per period. Flagged cells get a dark border.
+func (r Report) WriteSVG(w io.Writer) error {
+	width := labelWidth + cellWidth*len(r.Periods) + 10
+	height := headerHeight + cellHeight*len(r.Teams) + 10
+	periodIndex := map[int64]int{}
+	for i, period := range r.Periods {
+		periodIndex[period.Unix()] = i
+	}
+	teamIndex := map[string]int{}
+	for i, team := range r.Teams {
+		teamIndex[team] = i
+	}
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="10">`+"\n", width, height)
+	fmt.Fprintf(&svg, `<rect width="%d" height="%d" fill="white"/>`+"\n", width, height)
+
+	labelFormat := "2 Jan"
+	if r.By == ByDay {
+		labelFormat = "Mon 2"
+	}
+	for i, period := range r.Periods {
+		x := labelWidth + cellWidth*i + cellWidth/2
+		fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="middle">%s</text>`+"\n", x, headerHeight-8, period.Format(labelFormat))
+	}
+	for i, team := range r.Teams {
+		y := headerHeight + cellHeight*i + cellHeight/2 + 4
+		fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="end">%s</text>`+"\n", labelWidth-6, y, html.EscapeString(team))
+	}
+
+	for _, cell := range r.Cells {
+		col, ok := periodIndex[cell.Period.Unix()]
+		if !ok {
+			continue
+		}
+		x := labelWidth + cellWidth*col
+		y := headerHeight + cellHeight*teamIndex[cell.Team]
+		stroke := "white"
+		if r.isFlagged(cell) {
+			stroke = "black"
+		}
+		fmt.Fprintf(&svg, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" stroke="%s"><title>%s %s: %.0f%% available</title></rect>`+"\n",
+			x, y, cellWidth, cellHeight, cellColor(cell.AvailablePercent()), stroke,
+			html.EscapeString(cell.Team), cell.Period.Format("2 Jan"), cell.AvailablePercent())
+		fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="middle">%.0f</text>`+"\n", x+cellWidth/2, y+cellHeight/2+4, cell.AvailablePercent())
+	}
+	svg.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, svg.String())
+	return err
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/alert"
+	"github.com/jainmickey/justworks_integration/api"
+	"github.com/jainmickey/justworks_integration/capacity"
+	"github.com/jainmickey/justworks_integration/environment"
+	"github.com/jainmickey/justworks_integration/forecast"
+	"github.com/jainmickey/justworks_integration/harvest"
+	"github.com/jainmickey/justworks_integration/holidays"
+	"github.com/jainmickey/justworks_integration/justworks"
+	"github.com/jainmickey/justworks_integration/reminders"
+	"github.com/jainmickey/justworks_integration/report"
+	"github.com/jainmickey/justworks_integration/slacknotifier"
+	"github.com/jainmickey/justworks_integration/state"
+)
+
+const dateLayout = "2006-01-02"
+
+// commandContext is what every command needs: config, the state store, the
+// alerter, the holidays and a fresh copy of the Justworks calendar.
+type commandContext struct {
+	config   *environment.Config
+	store    *state.Store
+	alerter  alert.Alerter
+	calendar *holidays.Calendar
+}
+
+func newCommandContext() (*commandContext, error) {
+	config, err := environment.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	store, err := state.Load(config.Storage.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	alerter := alert.New(config, store)
+	calendar, err := holidays.Load(config.Holidays)
+	if err != nil {
+		fmt.Println("Error in loading holidays: ", err)
+	}
+	justworksFileStatus, err := justworks.DownloadJustWorksFile(config, store, alerter)
+	if justworksFileStatus == false {
+		return nil, fmt.Errorf("Error in fetching justworks file: %s", err)
+	}
+	return &commandContext{config: config, store: store, alerter: alerter, calendar: calendar}, nil
+}
+
+func (ctx *commandContext) forecastPeople() []forecast.ForecastPerson {
+	var forecastPeople []forecast.ForecastPerson
+	if ctx.config.Forecast.Enabled {
+		forecastPeople, _ = forecast.GetPeopleDetailsFromForecast(ctx.config, ctx.alerter)
+	}
+	return forecastPeople
+}
+
+func parseDateFlag(name string, value string) (time.Time, error) {
+	date, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return date, fmt.Errorf("-%s must look like %s, got %q", name, dateLayout, value)
+	}
+	return date, nil
+}
+
+func openOutput(filename string) (io.WriteCloser, error) {
+	if len(filename) == 0 || filename == "-" {
+		return os.Stdout, nil
+	}
+	return os.Create(filename)
+}
+
+func reportCommand(args []string) error {
+	now := time.Now().UTC()
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	from := flags.String("from", fmt.Sprintf("%d-01-01", now.Year()), "first day of the report (YYYY-MM-DD)")
+	to := flags.String("to", now.Format(dateLayout), "last day of the report (YYYY-MM-DD)")
+	groupBy := flags.String("group", report.ByMonth, "month, quarter or total")
+	format := flags.String("format", "csv", "csv, json or slack")
+	output := flags.String("out", "-", "file to write to, - for stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	fromDate, err := parseDateFlag("from", *from)
+	if err != nil {
+		return err
+	}
+	toDate, err := parseDateFlag("to", *to)
+	if err != nil {
+		return err
+	}
+	toDate = toDate.AddDate(0, 0, 1)
+	if *groupBy != report.ByMonth && *groupBy != report.ByQuarter && *groupBy != report.ByTotal {
+		return fmt.Errorf("-group must be month, quarter or total, got %q", *groupBy)
+	}
+
+	ctx, err := newCommandContext()
+	if err != nil {
+		return err
+	}
+	defer ctx.store.Save()
+
+	eventsList, err := justworks.GetOverlapping(fromDate, toDate, ctx.config)
+	if err != nil {
+		return err
+	}
+	forecastPeople := ctx.forecastPeople()
+	calendarFor := forecast.CalendarForEvents(forecastPeople, ctx.config.Holidays, ctx.calendar)
+	ptoReport := report.Build(eventsList, fromDate, toDate, *groupBy, calendarFor, forecast.PersonForEvents(forecastPeople))
+
+	out, err := openOutput(*output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	switch *format {
+	case "csv":
+		return ptoReport.WriteCSV(out)
+	case "json":
+		return ptoReport.WriteJSON(out)
+	case "slack":
+		message := ptoReport.SlackSummary()
+		fmt.Fprintln(out, message)
+		if len(ctx.config.Slack.ReportsWebhookURL) > 0 {
+			slackConn := slacknotifier.New(ctx.config.Slack.ReportsWebhookURL.Value())
+			return slackConn.Notify(message)
+		}
+		return nil
+	}
+	return fmt.Errorf("-format must be csv, json or slack, got %q", *format)
+}
+
+func capacityCommand(args []string) error {
+	nextMonth := time.Now().UTC().AddDate(0, 1, 0)
+	firstOfNextMonth := time.Date(nextMonth.Year(), nextMonth.Month(), 1, 0, 0, 0, 0, time.UTC)
+	flags := flag.NewFlagSet("capacity", flag.ContinueOnError)
+	from := flags.String("from", firstOfNextMonth.Format(dateLayout), "first day of the report (YYYY-MM-DD)")
+	to := flags.String("to", firstOfNextMonth.AddDate(0, 1, -1).Format(dateLayout), "last day of the report (YYYY-MM-DD)")
+	by := flags.String("by", capacity.ByDay, "day or week")
+	threshold := flags.Int("threshold", -1, "flag days where more than this percent of a team is out, CapacityThresholdPercent by default")
+	format := flags.String("format", "slack", "slack, csv or svg")
+	output := flags.String("out", "-", "file to write to, - for stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	fromDate, err := parseDateFlag("from", *from)
+	if err != nil {
+		return err
+	}
+	toDate, err := parseDateFlag("to", *to)
+	if err != nil {
+		return err
+	}
+	toDate = toDate.AddDate(0, 0, 1)
+	if *by != capacity.ByDay && *by != capacity.ByWeek {
+		return fmt.Errorf("-by must be day or week, got %q", *by)
+	}
+
+	ctx, err := newCommandContext()
+	if err != nil {
+		return err
+	}
+	defer ctx.store.Save()
+	if !ctx.config.Forecast.Enabled {
+		return fmt.Errorf("the capacity report needs Forecast for teams and working days, set ForecastEnabled=true")
+	}
+	if *threshold < 0 {
+		*threshold = ctx.config.Capacity.ThresholdPercent
+	}
+
+	eventsList, err := justworks.GetOverlapping(fromDate, toDate, ctx.config)
+	if err != nil {
+		return err
+	}
+	members := capacity.Members(ctx.forecastPeople(), eventsList, ctx.config.Holidays, ctx.calendar)
+	capacityReport := capacity.Build(members, fromDate, toDate, *by, *threshold)
+
+	out, err := openOutput(*output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	switch *format {
+	case "csv":
+		return capacityReport.WriteCSV(out)
+	case "svg":
+		return capacityReport.WriteSVG(out)
+	case "slack":
+		message := capacityReport.SlackSummary()
+		fmt.Fprintln(out, message)
+		if len(ctx.config.Slack.CapacityWebhookURL) > 0 {
+			slackConn := slacknotifier.New(ctx.config.Slack.CapacityWebhookURL.Value())
+			return slackConn.Notify(message)
+		}
+		return nil
+	}
+	return fmt.Errorf("-format must be slack, csv or svg, got %q", *format)
+}
+
+// remindersCommand manages who gets PTO reminders, the reminders
+// themselves go out on the daily run.
+func remindersCommand(args []string) error {
+	flags := flag.NewFlagSet("reminders", flag.ContinueOnError)
+	optOut := flags.String("opt-out", "", "email of someone who doesn't want reminders")
+	optIn := flags.String("opt-in", "", "email of someone who wants reminders again")
+	list := flags.Bool("list", false, "list everyone who opted out")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	config, err := environment.LoadConfig()
+	if err != nil {
+		return err
+	}
+	store, err := state.Load(config.Storage.Bucket)
+	if err != nil {
+		return err
+	}
+	if len(*optOut) > 0 {
+		reminders.SetOptOut(store, *optOut, true)
+		fmt.Println("Opted out", *optOut)
+	}
+	if len(*optIn) > 0 {
+		reminders.SetOptOut(store, *optIn, false)
+		fmt.Println("Opted in", *optIn)
+	}
+	if *list {
+		for _, email := range reminders.OptedOut(store) {
+			fmt.Println(email)
+		}
+	}
+	return store.Save()
+}
+
+// conflictsCommand prints every current conflict, not just the new ones the
+// daily run sends.
+func conflictsCommand(args []string) error {
+	flags := flag.NewFlagSet("conflicts", flag.ContinueOnError)
+	days := flags.Int("days", 0, "how many days ahead to look, ConflictsLookaheadDays by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, err := newCommandContext()
+	if err != nil {
+		return err
+	}
+	defer ctx.store.Save()
+	if !ctx.config.Forecast.Enabled {
+		return fmt.Errorf("the conflicts report needs Forecast, set ForecastEnabled=true")
+	}
+	if *days > 0 {
+		ctx.config.Conflicts.LookaheadDays = *days
+	}
+
+	managers, byManager := forecast.GroupByManager(upcomingConflicts(ctx.config, ctx.alerter, ctx.calendar))
+	if len(managers) == 0 {
+		fmt.Println("No conflicts.")
+	}
+	for _, manager := range managers {
+		fmt.Println(forecast.CreateConflictsMessage(manager, byManager[manager]))
+	}
+	return nil
+}
+
+func harvestDiffCommand(args []string) error {
+	now := time.Now().UTC()
+	flags := flag.NewFlagSet("harvest-diff", flag.ContinueOnError)
+	from := flags.String("from", now.AddDate(0, -1, 0).Format(dateLayout), "first day to compare (YYYY-MM-DD)")
+	to := flags.String("to", now.Format(dateLayout), "last day to compare (YYYY-MM-DD)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	fromDate, err := parseDateFlag("from", *from)
+	if err != nil {
+		return err
+	}
+	toDate, err := parseDateFlag("to", *to)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := newCommandContext()
+	if err != nil {
+		return err
+	}
+	defer ctx.store.Save()
+	if !ctx.config.Harvest.Enabled {
+		return fmt.Errorf("Harvest isn't configured, set HarvestEnabled=true")
+	}
+
+	eventsList, err := justworks.GetOverlapping(fromDate, toDate.AddDate(0, 0, 1), ctx.config)
+	if err != nil {
+		return err
+	}
+	differences, err := harvest.Differences(ctx.forecastPeople(), eventsList, ctx.config, ctx.calendar, fromDate, toDate)
+	if err != nil {
+		return err
+	}
+	fmt.Println(harvest.CreateDifferencesMessage(differences, fromDate, toDate))
+	return nil
+}
+
+// serveCommand runs the HTTP API until it's stopped.
+func serveCommand(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("addr", "", "address to listen on, ServerAddr by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	config, err := environment.LoadConfig()
+	if err != nil {
+		return err
+	}
+	if len(*addr) > 0 {
+		config.Server.Addr = *addr
+	}
+	store, err := state.Load(config.Storage.Bucket)
+	if err != nil {
+		return err
+	}
+	alerter := alert.New(config, store)
+	calendar, err := holidays.Load(config.Holidays)
+	if err != nil {
+		fmt.Println("Error in loading holidays: ", err)
+	}
+	return api.New(config, store, alerter, calendar).ListenAndServe()
+}
+
+var commands = map[string]func(args []string) error{
+	"serve":        serveCommand,
+	"harvest-diff": harvestDiffCommand,
+	"conflicts":    conflictsCommand,
+	"report":       reportCommand,
+	"capacity":     capacityCommand,
+	"reminders":    remindersCommand,
+}
+
+func runCommand(name string, args []string) int {
+	command, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n", name)
+		return 2
+	}
+	if err := command(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
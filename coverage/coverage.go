@@ -0,0 +1,154 @@
+package coverage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/capacity"
+	"github.com/jainmickey/justworks_integration/environment"
+	"github.com/jainmickey/justworks_integration/slacknotifier"
+	"github.com/jainmickey/justworks_integration/state"
+	"github.com/jainmickey/justworks_integration/workcal"
+)
+
+const warningsSentKey = "coverage_warnings_sent"
+
+// Someone out for half a day or more isn't counted as available.
+const outFromFraction = 0.5
+
+// Violation is one working day where a rule isn't met.
+type Violation struct {
+	Rule      environment.CoverageRule
+	Date      time.Time
+	Out       []string
+	Available int
+}
+
+func inTeam(member capacity.Member, role string) bool {
+	for _, team := range member.Teams {
+		if strings.EqualFold(team, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check looks at every day from from to to (to not included) and returns
+// the days each rule is broken, in date order. Only people scheduled to
+// work that day count, so a team-wide holiday is never a violation.
+func Check(rules []environment.CoverageRule, members []capacity.Member, from time.Time, to time.Time) []Violation {
+	var violations []Violation
+	for _, rule := range rules {
+		for date := workcal.Day(from); date.Before(to); date = date.AddDate(0, 0, 1) {
+			var out []string
+			scheduled := 0
+			for _, member := range members {
+				if !inTeam(member, rule.Role) || !member.Calendar.IsWorkingDay(date) {
+					continue
+				}
+				scheduled++
+				if member.OutOn(date) >= outFromFraction {
+					out = append(out, member.Name)
+				}
+			}
+			if scheduled == 0 || len(out) == 0 {
+				continue
+			}
+			available := scheduled - len(out)
+			if (rule.MinAvailable > 0 && available < rule.MinAvailable) || (rule.MaxOut > 0 && len(out) > rule.MaxOut) {
+				sort.Strings(out)
+				violations = append(violations, Violation{Rule: rule, Date: date, Out: out, Available: available})
+			}
+		}
+	}
+	return violations
+}
+
+func (v Violation) key() string {
+	return fmt.Sprintf("%s|%s|%s", v.Rule.Role, v.Date.Format("2006-01-02"), strings.Join(v.Out, ","))
+}
+
+func (v Violation) Text() string {
+	need := fmt.Sprintf("at most %d out", v.Rule.MaxOut)
+	if v.Rule.MinAvailable > 0 {
+		need = fmt.Sprintf("needs %d available", v.Rule.MinAvailable)
+	}
+	return fmt.Sprintf("%s: %d available, %s out (%s)", v.Date.Format("Mon, 2 Jan"), v.Available, strings.Join(v.Out, ", "), need)
+}
+
+// CreateWarningMessage groups the violations of one rule.
+func CreateWarningMessage(role string, violations []Violation) string {
+	messaging := fmt.Sprintf(":rotating_light: *Coverage warning for %s*:\n\n", role)
+	for _, v := range violations {
+		messaging = fmt.Sprintf("%s- %s\n", messaging, v.Text())
+	}
+	return messaging
+}
+
+// NewViolations drops the violations already warned about, so the same
+// people out on the same day are only reported once. Days in the past are
+// forgotten.
+func NewViolations(violations []Violation, store *state.Store, now time.Time) []Violation {
+	sent := map[string]time.Time{}
+	store.Get(warningsSentKey, &sent)
+	for key, date := range sent {
+		if date.Before(workcal.Day(now)) {
+			delete(sent, key)
+		}
+	}
+
+	var fresh []Violation
+	for _, v := range violations {
+		if _, ok := sent[v.key()]; ok {
+			continue
+		}
+		sent[v.key()] = v.Date
+		fresh = append(fresh, v)
+	}
+	store.Set(warningsSentKey, sent)
+	return fresh
+}
+
+// Notify posts one message per rule to its webhook, falling back to the
+// Product and Accounts channel, and direct messages the rule's managers
+// when a bot token is set.
+func Notify(violations []Violation, config *environment.Config) {
+	var roles []string
+	byRole := map[string][]Violation{}
+	for _, v := range violations {
+		if _, ok := byRole[v.Rule.Role]; !ok {
+			roles = append(roles, v.Rule.Role)
+		}
+		byRole[v.Rule.Role] = append(byRole[v.Rule.Role], v)
+	}
+
+	for _, role := range roles {
+		rule := byRole[role][0].Rule
+		message := CreateWarningMessage(role, byRole[role])
+		fmt.Println("Coverage Message", message)
+		if config.Slack.Enabled == false {
+			continue
+		}
+
+		webhookURL := rule.WebhookURL
+		if len(webhookURL) == 0 {
+			webhookURL = config.Slack.ProductAndAccountWebhookURL
+		}
+		slackConn := slacknotifier.New(webhookURL.Value())
+		if err := slackConn.Notify(message); err != nil {
+			fmt.Println("Error in posting coverage warning", role, err)
+		}
+
+		if len(config.Slack.BotToken) == 0 {
+			continue
+		}
+		client := slacknotifier.NewClient(config.Slack.BotToken.Value())
+		for _, manager := range rule.Managers {
+			if err := client.SendDirectMessage(manager, message); err != nil {
+				fmt.Println("Error in messaging manager", manager, err)
+			}
+		}
+	}
+}
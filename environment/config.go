@@ -0,0 +1,484 @@
+package environment
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Secret holds a credential. It is masked whenever it's printed so the
+// config can be logged safely.
+type Secret string
+
+func (s Secret) String() string {
+	if len(s) == 0 {
+		return ""
+	}
+	return "********"
+}
+
+func (s Secret) GoString() string {
+	return fmt.Sprintf("%q", s.String())
+}
+
+func (s Secret) Value() string {
+	return string(s)
+}
+
+type JustWorksConfig struct {
+	URL Secret `yaml:"url"`
+}
+
+type ForecastConfig struct {
+	Enabled          bool   `yaml:"enabled"`
+	APIURL           string `yaml:"api_url"`
+	Token            Secret `yaml:"token"`
+	AccountID        string `yaml:"account_id"`
+	TimeOffProjectID string `yaml:"time_off_project_id"`
+	// Time off is booked on the project of the leave type if there's one,
+	// then on the project of the person's first mapped role, and on
+	// TimeOffProjectID otherwise.
+	TimeOffProjectsByLeaveType map[string]string `yaml:"time_off_projects_by_leave_type"`
+	TimeOffProjectsByRole      map[string]string `yaml:"time_off_projects_by_role"`
+}
+
+// TimeOffProjectIDs are all the projects time off may be booked on.
+func (fc ForecastConfig) TimeOffProjectIDs() []string {
+	ids := []string{fc.TimeOffProjectID}
+	for _, projects := range []map[string]string{fc.TimeOffProjectsByLeaveType, fc.TimeOffProjectsByRole} {
+		for _, id := range projects {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// HarvestConfig books vacation days as time entries on a Time Off task.
+// People are matched through the Harvest user ID Forecast has for them.
+type HarvestConfig struct {
+	Enabled          bool   `yaml:"enabled"`
+	APIURL           string `yaml:"api_url"`
+	Token            Secret `yaml:"token"`
+	AccountID        string `yaml:"account_id"`
+	TimeOffProjectID int    `yaml:"time_off_project_id"`
+	TimeOffTaskID    int    `yaml:"time_off_task_id"`
+	DaysBack         int    `yaml:"days_back"`
+	DaysAhead        int    `yaml:"days_ahead"`
+}
+
+type SlackConfig struct {
+	Enabled                     bool   `yaml:"enabled"`
+	WebhookURL                  Secret `yaml:"webhook_url"`
+	ProductAndAccountWebhookURL Secret `yaml:"product_and_account_webhook_url"`
+	ChangesWebhookURL           Secret `yaml:"changes_webhook_url"`
+	ReportsWebhookURL           Secret `yaml:"reports_webhook_url"`
+	CapacityWebhookURL          Secret `yaml:"capacity_webhook_url"`
+	ConflictsWebhookURL         Secret `yaml:"conflicts_webhook_url"`
+	// BotToken is a Slack app token with chat:write and users:read.email,
+	// used for direct messages.
+	BotToken Secret `yaml:"bot_token"`
+	// UserToken is a workspace admin's token with users:read.email and
+	// users.profile:write, Slack only lets admins set other people's status.
+	UserToken Secret `yaml:"user_token"`
+	// SigningSecret verifies requests Slack sends to the API server, like
+	// slash commands.
+	SigningSecret Secret `yaml:"signing_secret"`
+	// DigestButtons adds Block Kit buttons to the daily digest. Clicks go
+	// to the API server's /slack/interactions.
+	DigestButtons bool `yaml:"digest_buttons"`
+}
+
+type EmailConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	Host         string `yaml:"host"`
+	Port         string `yaml:"port"`
+	User         string `yaml:"user"`
+	Password     Secret `yaml:"password"`
+	DefaultFrom  string `yaml:"default_from"`
+	AdminAddress string `yaml:"admin"`
+}
+
+type AlertsConfig struct {
+	AdminSlackWebhookURL Secret `yaml:"admin_slack_webhook_url"`
+	DedupHours           int    `yaml:"dedup_hours"`
+}
+
+// FeedHealthConfig holds the thresholds for flagging a suspicious change in
+// the Justworks feed between runs.
+type FeedHealthConfig struct {
+	MaxEventDropPercent   int `yaml:"max_event_drop_percent"`
+	MaxUnparseablePercent int `yaml:"max_unparseable_percent"`
+	MinEventsToCompare    int `yaml:"min_events_to_compare"`
+}
+
+// HolidaysConfig maps each office to a .ics or .yaml holiday file. People
+// are put in an office by their Forecast role, DefaultOffice otherwise, and
+// the digest is skipped on DigestOffice's holidays.
+type HolidaysConfig struct {
+	Files         map[string]string `yaml:"files"`
+	OfficeRoles   map[string]string `yaml:"office_roles"`
+	DefaultOffice string            `yaml:"default_office"`
+	DigestOffice  string            `yaml:"digest_office"`
+}
+
+// CapacityConfig flags days where more than ThresholdPercent of a team is
+// out in the capacity report.
+type CapacityConfig struct {
+	ThresholdPercent int `yaml:"threshold_percent"`
+}
+
+// CoverageRule says how many people with Role must stay available, e.g.
+// MinAvailable 1 for Accounts or MaxOut 2 for iOS. Warnings go to
+// WebhookURL and Managers (emails) get a direct message.
+type CoverageRule struct {
+	Role         string   `yaml:"role"`
+	MinAvailable int      `yaml:"min_available"`
+	MaxOut       int      `yaml:"max_out"`
+	WebhookURL   Secret   `yaml:"webhook_url"`
+	Managers     []string `yaml:"managers"`
+}
+
+type CoverageConfig struct {
+	LookaheadDays int            `yaml:"lookahead_days"`
+	Rules         []CoverageRule `yaml:"rules"`
+}
+
+// RemindersConfig turns on the direct message people get WorkingDaysBefore
+// their own PTO. It needs Forecast and a Slack bot token.
+type RemindersConfig struct {
+	Enabled           bool `yaml:"enabled"`
+	WorkingDaysBefore int  `yaml:"working_days_before"`
+}
+
+// FollowConfig tells Subscriber when Colleague books or starts PTO. Both
+// are emails, Label says who the colleague is to them, e.g. "pair".
+type FollowConfig struct {
+	Subscriber string `yaml:"subscriber"`
+	Colleague  string `yaml:"colleague"`
+	Label      string `yaml:"label"`
+}
+
+// SubscriptionsConfig turns on direct messages about followed colleagues'
+// PTO. People also follow colleagues with the /ooo slash command.
+type SubscriptionsConfig struct {
+	Enabled bool           `yaml:"enabled"`
+	Follows []FollowConfig `yaml:"follows"`
+}
+
+// WebhookEndpoint gets PTO events as JSON signed with Secret. Events limits
+// the event types it gets, all of them when empty.
+type WebhookEndpoint struct {
+	URL    string   `yaml:"url"`
+	Secret Secret   `yaml:"secret"`
+	Events []string `yaml:"events"`
+}
+
+// WebhooksConfig sends PTO events to other systems. Failed deliveries are
+// tried MaxAttempts times, waiting InitialBackoffSeconds and doubling.
+type WebhooksConfig struct {
+	Enabled               bool              `yaml:"enabled"`
+	Endpoints             []WebhookEndpoint `yaml:"endpoints"`
+	MaxAttempts           int               `yaml:"max_attempts"`
+	InitialBackoffSeconds int               `yaml:"initial_backoff_seconds"`
+}
+
+// webhookEventTypes are the event types endpoints can ask for.
+var webhookEventTypes = []string{"pto.created", "pto.changed", "pto.cancelled", "pto.started", "pto.ended"}
+
+// StatusConfig turns on setting people's Slack status while they're away.
+type StatusConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// ConflictsConfig turns on the report of people with Forecast assignments
+// during their leave. Forecast has no project managers, so ProjectManagers
+// maps a project ID, code or name to the manager's email.
+type ConflictsConfig struct {
+	Enabled         bool              `yaml:"enabled"`
+	LookaheadDays   int               `yaml:"lookahead_days"`
+	ProjectManagers map[string]string `yaml:"project_managers"`
+	DefaultManager  string            `yaml:"default_manager"`
+}
+
+// FeedsConfig publishes an ICS feed of who's out per team, to S3 under
+// Prefix and/or to a CalDAV server with one collection per feed under
+// CalDAVURL. Teams maps a feed name to Forecast roles separated by "|".
+type FeedsConfig struct {
+	Enabled        bool              `yaml:"enabled"`
+	Bucket         string            `yaml:"bucket"`
+	Prefix         string            `yaml:"prefix"`
+	Teams          map[string]string `yaml:"teams"`
+	CalDAVURL      string            `yaml:"caldav_url"`
+	CalDAVUser     string            `yaml:"caldav_user"`
+	CalDAVPassword Secret            `yaml:"caldav_password"`
+}
+
+// ServerConfig is for the HTTP API server mode. APIKeys is a comma
+// separated list, any of which may call the API.
+type ServerConfig struct {
+	Addr           string `yaml:"addr"`
+	APIKeys        Secret `yaml:"api_keys"`
+	RefreshMinutes int    `yaml:"refresh_minutes"`
+}
+
+func (sc ServerConfig) Keys() []string {
+	var keys []string
+	for _, key := range strings.Split(sc.APIKeys.Value(), ",") {
+		if key = strings.TrimSpace(key); len(key) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+type StorageConfig struct {
+	Bucket string `yaml:"bucket"`
+}
+
+type Config struct {
+	JustWorks     JustWorksConfig     `yaml:"justworks"`
+	Forecast      ForecastConfig      `yaml:"forecast"`
+	Harvest       HarvestConfig       `yaml:"harvest"`
+	Slack         SlackConfig         `yaml:"slack"`
+	Email         EmailConfig         `yaml:"email"`
+	Alerts        AlertsConfig        `yaml:"alerts"`
+	FeedHealth    FeedHealthConfig    `yaml:"feed_health"`
+	Holidays      HolidaysConfig      `yaml:"holidays"`
+	Capacity      CapacityConfig      `yaml:"capacity"`
+	Coverage      CoverageConfig      `yaml:"coverage"`
+	Reminders     RemindersConfig     `yaml:"reminders"`
+	Status        StatusConfig        `yaml:"status"`
+	Conflicts     ConflictsConfig     `yaml:"conflicts"`
+	Subscriptions SubscriptionsConfig `yaml:"subscriptions"`
+	Webhooks      WebhooksConfig      `yaml:"webhooks"`
+	Feeds         FeedsConfig         `yaml:"feeds"`
+	Server        ServerConfig        `yaml:"server"`
+	Storage       StorageConfig       `yaml:"storage"`
+}
+
+// ValidationError collects every problem found in a Config so they can be
+// fixed in one go instead of one deploy at a time.
+type ValidationError []string
+
+func (ve ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration:\n  - %s", strings.Join(ve, "\n  - "))
+}
+
+// secretFields lists the values that may hold an ssm: or secretsmanager:
+// reference instead of the secret itself.
+func (c *Config) secretFields() map[string]*Secret {
+	fields := map[string]*Secret{
+		"JustWorksUrl":                     &c.JustWorks.URL,
+		"ForeCastApiToken":                 &c.Forecast.Token,
+		"HarvestApiToken":                  &c.Harvest.Token,
+		"SlackWebhookURL":                  &c.Slack.WebhookURL,
+		"ProductAndAccountSlackWebhookURL": &c.Slack.ProductAndAccountWebhookURL,
+		"ChangesSlackWebhookURL":           &c.Slack.ChangesWebhookURL,
+		"ReportsSlackWebhookURL":           &c.Slack.ReportsWebhookURL,
+		"CapacitySlackWebhookURL":          &c.Slack.CapacityWebhookURL,
+		"ConflictsSlackWebhookURL":         &c.Slack.ConflictsWebhookURL,
+		"EmailHostPassword":                &c.Email.Password,
+		"AdminSlackWebhookURL":             &c.Alerts.AdminSlackWebhookURL,
+		"SlackBotToken":                    &c.Slack.BotToken,
+		"SlackUserToken":                   &c.Slack.UserToken,
+		"SlackSigningSecret":               &c.Slack.SigningSecret,
+		"CalDAVPassword":                   &c.Feeds.CalDAVPassword,
+		"ServerAPIKeys":                    &c.Server.APIKeys,
+	}
+	for i := range c.Webhooks.Endpoints {
+		fields[fmt.Sprintf("webhook %s secret", c.Webhooks.Endpoints[i].URL)] = &c.Webhooks.Endpoints[i].Secret
+	}
+	for i := range c.Coverage.Rules {
+		fields[fmt.Sprintf("coverage rule %s webhook_url", c.Coverage.Rules[i].Role)] = &c.Coverage.Rules[i].WebhookURL
+	}
+	return fields
+}
+
+func defaultConfig() Config {
+	return Config{
+		Forecast: ForecastConfig{
+			Enabled: true,
+			APIURL:  "https://api.forecastapp.com",
+		},
+		Harvest: HarvestConfig{
+			APIURL:    "https://api.harvestapp.com/v2",
+			DaysBack:  7,
+			DaysAhead: 14,
+		},
+		Slack: SlackConfig{Enabled: true},
+		Email: EmailConfig{
+			Enabled:      true,
+			AdminAddress: "backend@fueled.com",
+		},
+		Alerts: AlertsConfig{DedupHours: 24},
+		FeedHealth: FeedHealthConfig{
+			MaxEventDropPercent:   30,
+			MaxUnparseablePercent: 5,
+			MinEventsToCompare:    20,
+		},
+		Capacity:  CapacityConfig{ThresholdPercent: 30},
+		Coverage:  CoverageConfig{LookaheadDays: 14},
+		Reminders: RemindersConfig{WorkingDaysBefore: 2},
+		Conflicts: ConflictsConfig{LookaheadDays: 28},
+		Feeds:     FeedsConfig{Prefix: "feeds/"},
+		Server:    ServerConfig{Addr: ":8080", RefreshMinutes: 15},
+		Webhooks:  WebhooksConfig{MaxAttempts: 4, InitialBackoffSeconds: 1},
+	}
+}
+
+func (c *Config) Validate() error {
+	var problems ValidationError
+	require := func(value, name, hint string) {
+		if len(strings.TrimSpace(value)) == 0 {
+			problems = append(problems, fmt.Sprintf("%s must be set%s", name, hint))
+		}
+	}
+
+	require(c.JustWorks.URL.Value(), "JustWorksUrl", "")
+	require(c.Storage.Bucket, "AWS_STORAGE_BUCKET_NAME", "")
+
+	if c.Forecast.Enabled {
+		hint := " (or set ForecastEnabled=false)"
+		require(c.Forecast.APIURL, "ForeCastApiUrl", hint)
+		require(c.Forecast.Token.Value(), "ForeCastApiToken", hint)
+		require(c.Forecast.AccountID, "ForeCastApiAccountId", hint)
+		require(c.Forecast.TimeOffProjectID, "ForeCastApiTimeOffProjectID", hint)
+	}
+	if c.Harvest.Enabled {
+		hint := " (or set HarvestEnabled=false)"
+		require(c.Harvest.APIURL, "HarvestApiUrl", hint)
+		require(c.Harvest.Token.Value(), "HarvestApiToken", hint)
+		require(c.Harvest.AccountID, "HarvestAccountId", hint)
+		if c.Harvest.TimeOffProjectID <= 0 || c.Harvest.TimeOffTaskID <= 0 {
+			problems = append(problems, "HarvestTimeOffProjectID and HarvestTimeOffTaskID must be set to Harvest's numeric IDs"+hint)
+		}
+		if !c.Forecast.Enabled {
+			problems = append(problems, "Harvest needs Forecast for people's Harvest user IDs, set ForecastEnabled=true"+hint)
+		}
+		if c.Harvest.DaysBack < 0 || c.Harvest.DaysAhead < 0 {
+			problems = append(problems, "HarvestDaysBack and HarvestDaysAhead can't be negative")
+		}
+	}
+	if c.Slack.Enabled {
+		require(c.Slack.ProductAndAccountWebhookURL.Value(), "ProductAndAccountSlackWebhookURL", " (or set SlackEnabled=false)")
+	}
+	if c.Email.Enabled {
+		hint := " (or set EmailEnabled=false)"
+		require(c.Email.Host, "EmailHost", hint)
+		require(c.Email.Port, "EmailPort", hint)
+		require(c.Email.User, "EmailHostUser", hint)
+		require(c.Email.Password.Value(), "EmailHostPassword", hint)
+		require(c.Email.DefaultFrom, "DefaultFromEmail", hint)
+		require(c.Email.AdminAddress, "AdminEmail", hint)
+	}
+
+	if c.Alerts.DedupHours < 0 {
+		problems = append(problems, "AlertDedupHours can't be negative")
+	}
+
+	if c.Capacity.ThresholdPercent < 0 || c.Capacity.ThresholdPercent > 100 {
+		problems = append(problems, "CapacityThresholdPercent must be between 0 and 100")
+	}
+
+	if c.Reminders.Enabled {
+		hint := " (or set RemindersEnabled=false)"
+		require(c.Slack.BotToken.Value(), "SlackBotToken", hint)
+		if !c.Forecast.Enabled {
+			problems = append(problems, "reminders need Forecast to find people's emails, set ForecastEnabled=true"+hint)
+		}
+		if c.Reminders.WorkingDaysBefore < 1 {
+			problems = append(problems, "ReminderWorkingDaysBefore must be at least 1")
+		}
+	}
+
+	if c.Status.Enabled {
+		hint := " (or set StatusSyncEnabled=false)"
+		require(c.Slack.UserToken.Value(), "SlackUserToken", hint)
+		if !c.Forecast.Enabled {
+			problems = append(problems, "status sync needs Forecast to find people's emails, set ForecastEnabled=true"+hint)
+		}
+	}
+
+	if c.Subscriptions.Enabled {
+		require(c.Slack.BotToken.Value(), "SlackBotToken", " (or set SubscriptionsEnabled=false)")
+	}
+	for i, follow := range c.Subscriptions.Follows {
+		if len(follow.Subscriber) == 0 || len(follow.Colleague) == 0 {
+			problems = append(problems, fmt.Sprintf("subscription %d needs a subscriber and a colleague", i+1))
+		}
+	}
+
+	if c.Webhooks.Enabled && len(c.Webhooks.Endpoints) == 0 {
+		problems = append(problems, "webhooks need at least one endpoint in the config file (or set WebhooksEnabled=false)")
+	}
+	for i, endpoint := range c.Webhooks.Endpoints {
+		if len(endpoint.URL) == 0 {
+			problems = append(problems, fmt.Sprintf("webhook endpoint %d needs a url", i+1))
+		}
+		if len(endpoint.Secret) == 0 {
+			problems = append(problems, fmt.Sprintf("webhook %s needs a secret to sign events with", endpoint.URL))
+		}
+		for _, eventType := range endpoint.Events {
+			known := false
+			for _, knownType := range webhookEventTypes {
+				known = known || eventType == knownType
+			}
+			if !known {
+				problems = append(problems, fmt.Sprintf("webhook %s has unknown event %s, use one of %s", endpoint.URL, eventType, strings.Join(webhookEventTypes, ", ")))
+			}
+		}
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		problems = append(problems, "WebhookMaxAttempts must be at least 1")
+	}
+	if c.Webhooks.InitialBackoffSeconds < 0 {
+		problems = append(problems, "WebhookInitialBackoffSeconds can't be negative")
+	}
+
+	if c.Conflicts.Enabled {
+		if !c.Forecast.Enabled {
+			problems = append(problems, "the conflicts report needs Forecast, set ForecastEnabled=true (or set ConflictsEnabled=false)")
+		}
+		if c.Conflicts.LookaheadDays < 1 {
+			problems = append(problems, "ConflictsLookaheadDays must be at least 1")
+		}
+	}
+
+	if c.Server.RefreshMinutes < 1 {
+		problems = append(problems, "ServerRefreshMinutes must be at least 1")
+	}
+
+	if c.Coverage.LookaheadDays < 0 {
+		problems = append(problems, "CoverageLookaheadDays can't be negative")
+	}
+	for i, rule := range c.Coverage.Rules {
+		if len(strings.TrimSpace(rule.Role)) == 0 {
+			problems = append(problems, fmt.Sprintf("coverage rule %d needs a role", i+1))
+		}
+		if rule.MinAvailable <= 0 && rule.MaxOut <= 0 {
+			problems = append(problems, fmt.Sprintf("coverage rule %s needs min_available or max_out", rule.Role))
+		}
+	}
+
+	if c.FeedHealth.MaxEventDropPercent < 0 || c.FeedHealth.MaxEventDropPercent > 100 {
+		problems = append(problems, "FeedHealthMaxEventDropPercent must be between 0 and 100")
+	}
+	if c.FeedHealth.MaxUnparseablePercent < 0 || c.FeedHealth.MaxUnparseablePercent > 100 {
+		problems = append(problems, "FeedHealthMaxUnparseablePercent must be between 0 and 100")
+	}
+
+	for _, office := range []string{c.Holidays.DefaultOffice, c.Holidays.DigestOffice} {
+		if _, ok := c.Holidays.Files[office]; len(office) > 0 && !ok {
+			problems = append(problems, fmt.Sprintf("No holiday file for office %s in HolidayFiles", office))
+		}
+	}
+	for role, office := range c.Holidays.OfficeRoles {
+		if _, ok := c.Holidays.Files[office]; !ok {
+			problems = append(problems, fmt.Sprintf("Role %s is mapped to office %s which has no holiday file", role, office))
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
@@ -2,39 +2,223 @@ package environment
 
 import (
 	"fmt"
-	"log"
+	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jainmickey/justworks_integration/secrets"
+	"gopkg.in/yaml.v2"
 )
 
-func getEnvWithDefault(key, fallback string) string {
-	if value, ok := os.LookupEnv(key); ok {
-		return value
-	}
-	return fallback
-}
-
-func GetEnvironmentVars() (map[string]string, error) {
-	envVars := map[string]string{}
-	envVars["JustWorksUrl"] = getEnvWithDefault("JustWorksUrl", "")
-	envVars["ForeCastApiUrl"] = getEnvWithDefault("ForeCastApiUrl", "https://api.forecastapp.com")
-	envVars["ForeCastApiToken"] = getEnvWithDefault("ForeCastApiToken", "")
-	envVars["ForeCastApiAccountId"] = getEnvWithDefault("ForeCastApiAccountId", "")
-	envVars["ForeCastApiTimeOffProjectID"] = getEnvWithDefault("ForeCastApiTimeOffProjectID", "")
-	envVars["SlackWebhookURL"] = getEnvWithDefault("SlackWebhookURL", "")
-	envVars["ProductAndAccountSlackWebhookURL"] = getEnvWithDefault("ProductAndAccountSlackWebhookURL", "")
-	envVars["AWS_STORAGE_BUCKET_NAME"] = getEnvWithDefault("AWS_STORAGE_BUCKET_NAME", "")
-	envVars["DefaultFromEmail"] = getEnvWithDefault("DefaultFromEmail", "")
-	envVars["AdminEmail"] = getEnvWithDefault("AdminEmail", "backend@fueled.com")
-	envVars["EmailHost"] = getEnvWithDefault("EmailHost", "")
-	envVars["EmailHostPassword"] = getEnvWithDefault("EmailHostPassword", "")
-	envVars["EmailHostUser"] = getEnvWithDefault("EmailHostUser", "")
-	envVars["EmailPort"] = getEnvWithDefault("EmailPort", "")
-
-	for k := range envVars {
-		if envVars[k] == "" {
-			log.Fatal(fmt.Sprintf("$%s must be set", k))
+func setFromEnv(target *string, key string) {
+	if value, ok := os.LookupEnv(key); ok && len(value) > 0 {
+		*target = value
+	}
+}
+
+func setSecretFromEnv(target *Secret, key string) {
+	if value, ok := os.LookupEnv(key); ok && len(value) > 0 {
+		*target = Secret(value)
+	}
+}
+
+func setBoolFromEnv(target *bool, key string) error {
+	value, ok := os.LookupEnv(key)
+	if !ok || len(value) == 0 {
+		return nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("%s must be true or false, got %q", key, value)
+	}
+	*target = parsed
+	return nil
+}
+
+func setIntFromEnv(target *int, key string) error {
+	value, ok := os.LookupEnv(key)
+	if !ok || len(value) == 0 {
+		return nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%s must be a number, got %q", key, value)
+	}
+	*target = parsed
+	return nil
+}
+
+// setMapFromEnv reads "key=value,key=value" pairs.
+func setMapFromEnv(target *map[string]string, key string) error {
+	value, ok := os.LookupEnv(key)
+	if !ok || len(value) == 0 {
+		return nil
+	}
+	parsed := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 {
+			return fmt.Errorf("%s must look like key=value,key=value, got %q", key, value)
+		}
+		parsed[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	*target = parsed
+	return nil
+}
+
+func loadConfigFile(filename string, config *Config) error {
+	file, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("Can't read config file %s: %s", filename, err.Error())
+	}
+	err = yaml.Unmarshal(file, config)
+	if err != nil {
+		return fmt.Errorf("Can't parse config file %s: %s", filename, err.Error())
+	}
+	return nil
+}
+
+func applyEnvironmentVars(config *Config) ValidationError {
+	var problems ValidationError
+
+	setSecretFromEnv(&config.JustWorks.URL, "JustWorksUrl")
+
+	setFromEnv(&config.Forecast.APIURL, "ForeCastApiUrl")
+	setSecretFromEnv(&config.Forecast.Token, "ForeCastApiToken")
+	setFromEnv(&config.Forecast.AccountID, "ForeCastApiAccountId")
+	setFromEnv(&config.Forecast.TimeOffProjectID, "ForeCastApiTimeOffProjectID")
+
+	setFromEnv(&config.Harvest.APIURL, "HarvestApiUrl")
+	setSecretFromEnv(&config.Harvest.Token, "HarvestApiToken")
+	setFromEnv(&config.Harvest.AccountID, "HarvestAccountId")
+
+	setSecretFromEnv(&config.Slack.WebhookURL, "SlackWebhookURL")
+	setSecretFromEnv(&config.Slack.ProductAndAccountWebhookURL, "ProductAndAccountSlackWebhookURL")
+	setSecretFromEnv(&config.Slack.ChangesWebhookURL, "ChangesSlackWebhookURL")
+	setSecretFromEnv(&config.Slack.ReportsWebhookURL, "ReportsSlackWebhookURL")
+	setSecretFromEnv(&config.Slack.CapacityWebhookURL, "CapacitySlackWebhookURL")
+	setSecretFromEnv(&config.Slack.ConflictsWebhookURL, "ConflictsSlackWebhookURL")
+	setSecretFromEnv(&config.Slack.BotToken, "SlackBotToken")
+	setSecretFromEnv(&config.Slack.UserToken, "SlackUserToken")
+	setSecretFromEnv(&config.Slack.SigningSecret, "SlackSigningSecret")
+
+	setFromEnv(&config.Email.Host, "EmailHost")
+	setFromEnv(&config.Email.Port, "EmailPort")
+	setFromEnv(&config.Email.User, "EmailHostUser")
+	setSecretFromEnv(&config.Email.Password, "EmailHostPassword")
+	setFromEnv(&config.Email.DefaultFrom, "DefaultFromEmail")
+	setFromEnv(&config.Email.AdminAddress, "AdminEmail")
+
+	setSecretFromEnv(&config.Alerts.AdminSlackWebhookURL, "AdminSlackWebhookURL")
+	if err := setIntFromEnv(&config.Alerts.DedupHours, "AlertDedupHours"); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	for key, target := range map[string]*int{
+		"FeedHealthMaxEventDropPercent":   &config.FeedHealth.MaxEventDropPercent,
+		"FeedHealthMaxUnparseablePercent": &config.FeedHealth.MaxUnparseablePercent,
+		"FeedHealthMinEventsToCompare":    &config.FeedHealth.MinEventsToCompare,
+		"CapacityThresholdPercent":        &config.Capacity.ThresholdPercent,
+		"CoverageLookaheadDays":           &config.Coverage.LookaheadDays,
+		"ReminderWorkingDaysBefore":       &config.Reminders.WorkingDaysBefore,
+		"ConflictsLookaheadDays":          &config.Conflicts.LookaheadDays,
+		"HarvestDaysBack":                 &config.Harvest.DaysBack,
+		"HarvestDaysAhead":                &config.Harvest.DaysAhead,
+		"HarvestTimeOffProjectID":         &config.Harvest.TimeOffProjectID,
+		"HarvestTimeOffTaskID":            &config.Harvest.TimeOffTaskID,
+		"ServerRefreshMinutes":            &config.Server.RefreshMinutes,
+		"WebhookMaxAttempts":              &config.Webhooks.MaxAttempts,
+		"WebhookInitialBackoffSeconds":    &config.Webhooks.InitialBackoffSeconds,
+	} {
+		if err := setIntFromEnv(target, key); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	for key, target := range map[string]*map[string]string{
+		"HolidayFiles":               &config.Holidays.Files,
+		"HolidayOfficeRoles":         &config.Holidays.OfficeRoles,
+		"ProjectManagers":            &config.Conflicts.ProjectManagers,
+		"TimeOffProjectsByLeaveType": &config.Forecast.TimeOffProjectsByLeaveType,
+		"TimeOffProjectsByRole":      &config.Forecast.TimeOffProjectsByRole,
+	} {
+		if err := setMapFromEnv(target, key); err != nil {
+			problems = append(problems, err.Error())
 		}
 	}
+	setFromEnv(&config.Holidays.DefaultOffice, "HolidaysDefaultOffice")
+	setFromEnv(&config.Holidays.DigestOffice, "HolidaysDigestOffice")
+	setFromEnv(&config.Conflicts.DefaultManager, "ConflictsDefaultManager")
+
+	setFromEnv(&config.Storage.Bucket, "AWS_STORAGE_BUCKET_NAME")
+
+	setFromEnv(&config.Feeds.Bucket, "FeedsBucket")
+	setFromEnv(&config.Feeds.Prefix, "FeedsPrefix")
+	setFromEnv(&config.Feeds.CalDAVURL, "CalDAVURL")
+	setFromEnv(&config.Feeds.CalDAVUser, "CalDAVUser")
+	setSecretFromEnv(&config.Feeds.CalDAVPassword, "CalDAVPassword")
+
+	setFromEnv(&config.Server.Addr, "ServerAddr")
+	setSecretFromEnv(&config.Server.APIKeys, "ServerAPIKeys")
 
-	return envVars, nil
+	for key, target := range map[string]*bool{
+		"ForecastEnabled":      &config.Forecast.Enabled,
+		"SlackEnabled":         &config.Slack.Enabled,
+		"SlackDigestButtons":   &config.Slack.DigestButtons,
+		"EmailEnabled":         &config.Email.Enabled,
+		"RemindersEnabled":     &config.Reminders.Enabled,
+		"StatusSyncEnabled":    &config.Status.Enabled,
+		"ConflictsEnabled":     &config.Conflicts.Enabled,
+		"HarvestEnabled":       &config.Harvest.Enabled,
+		"FeedsEnabled":         &config.Feeds.Enabled,
+		"SubscriptionsEnabled": &config.Subscriptions.Enabled,
+		"WebhooksEnabled":      &config.Webhooks.Enabled,
+	} {
+		if err := setBoolFromEnv(target, key); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return problems
+}
+
+func resolveSecrets(config *Config) ValidationError {
+	var problems ValidationError
+
+	resolver, err := secrets.DefaultResolver()
+	if err != nil {
+		return append(problems, err.Error())
+	}
+	for name, target := range config.secretFields() {
+		value, err := resolver.Resolve(target.Value())
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", name, err.Error()))
+			continue
+		}
+		*target = Secret(value)
+	}
+	return problems
+}
+
+// LoadConfig builds the configuration from the optional YAML file named by
+// $BootBotConfigFile and then the environment, which wins over the file.
+// Secret values may be ssm:/path or secretsmanager:id#key references.
+func LoadConfig() (*Config, error) {
+	config := defaultConfig()
+
+	if filename, ok := os.LookupEnv("BootBotConfigFile"); ok && len(filename) > 0 {
+		if err := loadConfigFile(filename, &config); err != nil {
+			return nil, err
+		}
+	}
+
+	problems := applyEnvironmentVars(&config)
+	problems = append(problems, resolveSecrets(&config)...)
+	if err := config.Validate(); err != nil {
+		problems = append(problems, err.(ValidationError)...)
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return &config, nil
 }
@@ -0,0 +1,31 @@
+package environment
+
+import "testing"
+
+func TestApplyEnvironmentVarsBools(t *testing.T) {
+	tests := []struct {
+		key     string
+		enabled func(config Config) bool
+	}{
+		{"SubscriptionsEnabled", func(config Config) bool { return config.Subscriptions.Enabled }},
+		{"WebhooksEnabled", func(config Config) bool { return config.Webhooks.Enabled }},
+	}
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			config := defaultConfig()
+			t.Setenv(test.key, "true")
+			if problems := applyEnvironmentVars(&config); len(problems) > 0 {
+				t.Errorf("unexpected problems %v", problems)
+			}
+			if !test.enabled(config) {
+				t.Errorf("%s=true didn't turn it on", test.key)
+			}
+
+			config = defaultConfig()
+			t.Setenv(test.key, "nope")
+			if problems := applyEnvironmentVars(&config); len(problems) != 1 {
+				t.Errorf("%s=nope: want one problem, got %v", test.key, problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package feeds
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/environment"
+	"github.com/jainmickey/justworks_integration/forecast"
+	"github.com/jainmickey/justworks_integration/justworks"
+	"github.com/jainmickey/justworks_integration/s3"
+	"github.com/jainmickey/justworks_integration/state"
+)
+
+const (
+	everyoneFeed          = "everyone"
+	productAndAccountFeed = "product-and-accounts"
+	calDAVUIDsKey         = "caldav_published_uids"
+)
+
+// Feed is the "who's out" calendar of one team.
+type Feed struct {
+	Name   string
+	Events []justworks.Event
+}
+
+func (feed Feed) Title() string {
+	return fmt.Sprintf("Who's out – %s", feed.Name)
+}
+
+func hasRole(fp forecast.ForecastPerson, roles []string) bool {
+	for _, role := range fp.RoleNames() {
+		for _, wanted := range roles {
+			if strings.EqualFold(role, strings.TrimSpace(wanted)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func uniqueEvents(events []justworks.Event) []justworks.Event {
+	seen := map[string]bool{}
+	var unique []justworks.Event
+	for _, ev := range events {
+		uid := EventUID(ev)
+		if seen[uid] {
+			continue
+		}
+		seen[uid] = true
+		unique = append(unique, ev)
+	}
+	sort.SliceStable(unique, func(i, j int) bool {
+		return unique[i].StartDate().Before(unique[j].StartDate())
+	})
+	return unique
+}
+
+// BuildFeeds makes the everyone feed, the Product and Accounts feed the
+// daily digest uses and one feed per configured team. Events are already
+// filtered to vacation and remote work like the digests.
+func BuildFeeds(forecastPeople []forecast.ForecastPerson, events []justworks.Event, config environment.FeedsConfig) []Feed {
+	feeds := []Feed{{Name: everyoneFeed, Events: uniqueEvents(events)}}
+	if len(forecastPeople) == 0 {
+		return feeds
+	}
+
+	productAndAccountsEvents, _, _ := forecast.FilterEventsForProductAndAccountsPeople(forecastPeople, events)
+	feeds = append(feeds, Feed{Name: productAndAccountFeed, Events: uniqueEvents(productAndAccountsEvents)})
+
+	var names []string
+	for name := range config.Teams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		roles := strings.Split(config.Teams[name], "|")
+		var teamEvents []justworks.Event
+		for _, fp := range forecastPeople {
+			if hasRole(fp, roles) {
+				teamEvents = append(teamEvents, forecast.EventsForPerson(fp, events)...)
+			}
+		}
+		feeds = append(feeds, Feed{Name: name, Events: uniqueEvents(teamEvents)})
+	}
+	return feeds
+}
+
+// PublishS3 writes every feed to <prefix><name>.ics.
+func PublishS3(feeds []Feed, config *environment.Config, now time.Time) {
+	bucket := config.Feeds.Bucket
+	if len(bucket) == 0 {
+		bucket = config.Storage.Bucket
+	}
+	for _, feed := range feeds {
+		key := fmt.Sprintf("%s%s.ics", config.Feeds.Prefix, feed.Name)
+		s3.UploadObject(bucket, key, feed.Render(now), "text/calendar; charset=utf-8")
+	}
+}
+
+func calDAVRequest(client *http.Client, method string, eventURL string, body []byte, config environment.FeedsConfig) error {
+	req, err := http.NewRequest(method, eventURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(config.CalDAVUser, config.CalDAVPassword.Value())
+	if body != nil {
+		req.Header.Set("Content-Type", "text/calendar; charset=utf-8")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 && !(method == "DELETE" && resp.StatusCode == 404) {
+		return fmt.Errorf("CalDAV %s %s: %s", method, eventURL, resp.Status)
+	}
+	return nil
+}
+
+// PublishCalDAV PUTs each event to <CalDAVURL>/<feed>/<uid>.ics, which
+// creates or replaces it, and deletes the events published last time that
+// are gone from the feed.
+func PublishCalDAV(feeds []Feed, config *environment.Config, store *state.Store, now time.Time) {
+	client := &http.Client{}
+	published := map[string][]string{}
+	store.Get(calDAVUIDsKey, &published)
+
+	for _, feed := range feeds {
+		collection := fmt.Sprintf("%s/%s", strings.TrimSuffix(config.Feeds.CalDAVURL, "/"), feed.Name)
+		current := map[string]bool{}
+		var uids []string
+		for _, ev := range feed.Events {
+			uid := EventUID(ev)
+			eventURL := fmt.Sprintf("%s/%s.ics", collection, uid)
+			if err := calDAVRequest(client, "PUT", eventURL, RenderEvent(feed, ev, now), config.Feeds); err != nil {
+				fmt.Println("Error in publishing to CalDAV", err)
+			}
+			current[uid] = true
+			uids = append(uids, uid)
+		}
+		for _, uid := range published[feed.Name] {
+			if current[uid] {
+				continue
+			}
+			if err := calDAVRequest(client, "DELETE", fmt.Sprintf("%s/%s.ics", collection, uid), nil, config.Feeds); err != nil {
+				fmt.Println("Error in removing from CalDAV", err)
+				uids = append(uids, uid)
+			}
+		}
+		published[feed.Name] = uids
+	}
+	store.Set(calDAVUIDsKey, published)
+}
@@ -0,0 +1,109 @@
+package feeds
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/justworks"
+)
+
+const (
+	icsDate     = "20060102"
+	icsDateTime = "20060102T150405Z"
+)
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+// foldLine splits content lines longer than 75 octets as RFC 5545 asks.
+// Continuation lines start with a space, so they hold 74 octets of content.
+func foldLine(line string) string {
+	var folded strings.Builder
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		// ---- Don't cut a UTF-8 character in half ----
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		folded.WriteString(line[:cut])
+		folded.WriteString("\r\n ")
+		line = line[cut:]
+		limit = 74
+	}
+	folded.WriteString(line)
+	return folded.String()
+}
+
+// EventUID stays the same between runs so calendar apps update an event
+// instead of adding a copy. It comes from the Justworks UID, or from who,
+// what and when for events without one.
+func EventUID(ev justworks.Event) string {
+	source := ev.UID()
+	if len(source) == 0 {
+		source = fmt.Sprintf("%s|%s|%s", ev.Name(), ev.EventType(), ev.StartDate().Format(icsDate))
+	}
+	return fmt.Sprintf("%x@bootbot", sha1.Sum([]byte(source)))
+}
+
+// Summary is e.g. "Rachel J. – Vacation".
+func Summary(ev justworks.Event) string {
+	return fmt.Sprintf("%s – %s", ev.Name(), ev.DisplayType())
+}
+
+func eventLines(ev justworks.Event, now time.Time) []string {
+	lines := []string{
+		"BEGIN:VEVENT",
+		fmt.Sprintf("UID:%s", EventUID(ev)),
+		fmt.Sprintf("DTSTAMP:%s", now.UTC().Format(icsDateTime)),
+		fmt.Sprintf("SUMMARY:%s", icsEscaper.Replace(Summary(ev))),
+	}
+	if ev.IsPartialDay() {
+		lines = append(lines,
+			fmt.Sprintf("DTSTART:%s", ev.StartDate().UTC().Format(icsDateTime)),
+			fmt.Sprintf("DTEND:%s", ev.EndDate().UTC().Format(icsDateTime)))
+	} else {
+		lines = append(lines,
+			fmt.Sprintf("DTSTART;VALUE=DATE:%s", ev.StartDate().Format(icsDate)),
+			fmt.Sprintf("DTEND;VALUE=DATE:%s", ev.LastDay().AddDate(0, 0, 1).Format(icsDate)))
+	}
+	if !ev.LastModified().IsZero() {
+		lines = append(lines, fmt.Sprintf("LAST-MODIFIED:%s", ev.LastModified().UTC().Format(icsDateTime)))
+	}
+	lines = append(lines,
+		fmt.Sprintf("SEQUENCE:%d", ev.Sequence()),
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT")
+	return lines
+}
+
+func render(name string, lines []string) []byte {
+	var ics strings.Builder
+	header := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//BootBot//Justworks Integration//EN",
+		"CALSCALE:GREGORIAN",
+		fmt.Sprintf("X-WR-CALNAME:%s", icsEscaper.Replace(name)),
+	}
+	for _, line := range append(append(header, lines...), "END:VCALENDAR") {
+		ics.WriteString(foldLine(line))
+		ics.WriteString("\r\n")
+	}
+	return []byte(ics.String())
+}
+
+// Render is the whole feed as one calendar.
+func (feed Feed) Render(now time.Time) []byte {
+	var lines []string
+	for _, ev := range feed.Events {
+		lines = append(lines, eventLines(ev, now)...)
+	}
+	return render(feed.Title(), lines)
+}
+
+// RenderEvent is a calendar with just ev, the unit CalDAV stores.
+func RenderEvent(feed Feed, ev justworks.Event, now time.Time) []byte {
+	return render(feed.Title(), eventLines(ev, now))
+}
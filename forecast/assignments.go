@@ -0,0 +1,94 @@
+package forecast
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/environment"
+)
+
+type Assignment struct {
+	ID         int    `json:"id"`
+	ProjectID  int    `json:"project_id"`
+	PersonID   int    `json:"person_id"`
+	StartDate  string `json:"start_date"`
+	EndDate    string `json:"end_date"`
+	Allocation int    `json:"allocation"`
+	Notes      string `json:"notes"`
+}
+
+type Project struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Code     string `json:"code"`
+	ClientID int    `json:"client_id"`
+	Archived bool   `json:"archived"`
+}
+
+func (a Assignment) IsTimeOff(config *environment.Config) bool {
+	for _, projectID := range config.Forecast.TimeOffProjectIDs() {
+		if fmt.Sprintf("%d", a.ProjectID) == projectID {
+			return true
+		}
+	}
+	return false
+}
+
+func forecastGet(config *environment.Config, path string, params url.Values, result interface{}) error {
+	requestURL := fmt.Sprintf("%s/%s", config.Forecast.APIURL, path)
+	if len(params) > 0 {
+		requestURL = fmt.Sprintf("%s?%s", requestURL, params.Encode())
+	}
+	client := &http.Client{}
+	req, _ := http.NewRequest("GET", requestURL, nil)
+	req.Header.Add("authorization", fmt.Sprintf("Bearer %s", config.Forecast.Token.Value()))
+	req.Header.Add("forecast-account-id", config.Forecast.AccountID)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Forecast %s: %s", path, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, result)
+}
+
+// GetAssignments returns the assignments that overlap start..end (both
+// included), for one person when personID isn't 0.
+func GetAssignments(config *environment.Config, start time.Time, end time.Time, personID int) ([]Assignment, error) {
+	dateLayout := "2006-01-02"
+	params := url.Values{
+		"start_date": {start.Format(dateLayout)},
+		"end_date":   {end.Format(dateLayout)},
+	}
+	if personID != 0 {
+		params.Set("person_id", fmt.Sprintf("%d", personID))
+	}
+	var raw struct {
+		Assignments []Assignment `json:"assignments"`
+	}
+	err := forecastGet(config, "assignments", params, &raw)
+	return raw.Assignments, err
+}
+
+func GetProjects(config *environment.Config) (map[int]Project, error) {
+	var raw struct {
+		Projects []Project `json:"projects"`
+	}
+	projects := map[int]Project{}
+	err := forecastGet(config, "projects", nil, &raw)
+	for _, project := range raw.Projects {
+		projects[project.ID] = project
+	}
+	return projects, err
+}
@@ -0,0 +1,174 @@
+package forecast
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/environment"
+	"github.com/jainmickey/justworks_integration/holidays"
+	"github.com/jainmickey/justworks_integration/justworks"
+	"github.com/jainmickey/justworks_integration/workcal"
+)
+
+// fullDayAllocation is what a null allocation, a whole day, counts as.
+const fullDayAllocation = justworks.WorkingHoursPerDay * 3600
+
+// Conflict is a person assigned to a project on days they're out.
+type Conflict struct {
+	Project   Project
+	Manager   string
+	Person    string
+	Email     string
+	Days      []time.Time
+	HoursLost float64
+	// Leave identifies the events behind it, by UID or else first day, and
+	// stays the same while the leave is under way.
+	Leave []string
+}
+
+// ProjectManager finds the manager of a project by ID, code or name.
+func ProjectManager(project Project, config environment.ConflictsConfig) string {
+	for _, key := range []string{fmt.Sprintf("%d", project.ID), project.Code, project.Name} {
+		if manager, ok := config.ProjectManagers[key]; ok && len(key) > 0 {
+			return manager
+		}
+	}
+	return config.DefaultManager
+}
+
+// FindConflicts crosses the assignments between from and to (to not
+// included) with the absences of the people they're for. Hours lost are the
+// assignment's daily allocation times how much of each working day is off.
+func FindConflicts(forecastPeople []ForecastPerson, events []justworks.Event, assignments []Assignment, projects map[int]Project,
+	config *environment.Config, calendar *holidays.Calendar, from time.Time, to time.Time) []Conflict {
+	people := map[int]ForecastPerson{}
+	for _, fp := range forecastPeople {
+		people[fp.id] = fp
+	}
+
+	var conflicts []Conflict
+	for _, assignment := range assignments {
+		fp, ok := people[assignment.PersonID]
+		if !ok || assignment.IsTimeOff(config) {
+			continue
+		}
+		project, ok := projects[assignment.ProjectID]
+		if !ok || project.Archived {
+			continue
+		}
+		start, err := time.Parse("2006-01-02", assignment.StartDate)
+		if err != nil {
+			continue
+		}
+		end, err := time.Parse("2006-01-02", assignment.EndDate)
+		if err != nil {
+			continue
+		}
+		allocation := assignment.Allocation
+		if allocation == 0 {
+			allocation = fullDayAllocation
+		}
+
+		personEvents := EventsForPerson(fp, events)
+		workingCalendar := WorkingCalendar(fp, config.Holidays, calendar)
+		conflict := Conflict{Project: project, Manager: ProjectManager(project, config.Conflicts), Person: fp.FullName(), Email: fp.email}
+		for date := workcal.Day(from); date.Before(to); date = date.AddDate(0, 0, 1) {
+			if date.Before(start) || date.After(end) || !workingCalendar.IsWorkingDay(date) {
+				continue
+			}
+			out := justworks.OutOn(personEvents, date)
+			if out == 0 {
+				continue
+			}
+			conflict.Days = append(conflict.Days, date)
+			conflict.HoursLost += out * float64(allocation) / 3600
+		}
+		for _, ev := range personEvents {
+			if overlapsDays(ev, conflict.Days) {
+				conflict.Leave = append(conflict.Leave, leaveKey(ev))
+			}
+		}
+		if len(conflict.Leave) == 0 && len(conflict.Days) > 0 {
+			conflict.Leave = []string{conflict.Days[0].Format("2006-01-02")}
+		}
+		if len(conflict.Days) > 0 {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		if conflicts[i].Manager != conflicts[j].Manager {
+			return conflicts[i].Manager < conflicts[j].Manager
+		}
+		if conflicts[i].Project.Name != conflicts[j].Project.Name {
+			return conflicts[i].Project.Name < conflicts[j].Project.Name
+		}
+		return conflicts[i].Person < conflicts[j].Person
+	})
+	return conflicts
+}
+
+func leaveKey(ev justworks.Event) string {
+	if len(ev.UID()) > 0 {
+		return ev.UID()
+	}
+	return workcal.Day(ev.StartDate()).Format("2006-01-02")
+}
+
+func overlapsDays(ev justworks.Event, days []time.Time) bool {
+	for _, date := range days {
+		if !date.Before(workcal.Day(ev.StartDate())) && !date.After(workcal.Day(ev.LastDay())) {
+			return true
+		}
+	}
+	return false
+}
+
+// GroupByManager keeps the managers in the order they first appear.
+func GroupByManager(conflicts []Conflict) ([]string, map[string][]Conflict) {
+	var managers []string
+	byManager := map[string][]Conflict{}
+	for _, conflict := range conflicts {
+		if _, ok := byManager[conflict.Manager]; !ok {
+			managers = append(managers, conflict.Manager)
+		}
+		byManager[conflict.Manager] = append(byManager[conflict.Manager], conflict)
+	}
+	return managers, byManager
+}
+
+func describeDays(days []time.Time) string {
+	var ranges []string
+	for i := 0; i < len(days); {
+		j := i
+		for j+1 < len(days) && days[j+1].Sub(days[j]) <= 3*24*time.Hour {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, days[i].Format("Mon 2 Jan"))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%s – %s", days[i].Format("Mon 2 Jan"), days[j].Format("Mon 2 Jan")))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ", ")
+}
+
+// CreateConflictsMessage is the report for one manager, per project.
+func CreateConflictsMessage(manager string, conflicts []Conflict) string {
+	heading := "Projects without a manager"
+	if len(manager) > 0 {
+		heading = fmt.Sprintf("Projects managed by %s", manager)
+	}
+	messaging := fmt.Sprintf(":warning: *People assigned to your projects who are out* (%s):\n", heading)
+	project := ""
+	for _, conflict := range conflicts {
+		if conflict.Project.Name != project {
+			project = conflict.Project.Name
+			messaging = fmt.Sprintf("%s\n*%s*\n", messaging, project)
+		}
+		messaging = fmt.Sprintf("%s- %s: %s (%.1f hours lost)\n", messaging, conflict.Person, describeDays(conflict.Days), conflict.HoursLost)
+	}
+	return messaging
+}
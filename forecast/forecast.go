@@ -6,11 +6,15 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/jainmickey/justworks_integration/alert"
+	"github.com/jainmickey/justworks_integration/environment"
+	"github.com/jainmickey/justworks_integration/holidays"
 	"github.com/jainmickey/justworks_integration/justworks"
-	"github.com/jainmickey/justworks_integration/ses"
 	"github.com/jainmickey/justworks_integration/utils"
+	"github.com/jainmickey/justworks_integration/workcal"
 )
 
 type ForecastPerson struct {
@@ -84,6 +88,15 @@ func (fp *ForecastPerson) setColorBlind(colorBlind bool) {
 	fp.colorBlind = colorBlind
 }
 
+func (fp *ForecastPerson) setWorkingDays(workingDays map[string]interface{}) {
+	fp.workingDays = map[string]bool{}
+	for day, working := range workingDays {
+		if val, ok := working.(bool); ok {
+			fp.workingDays[day] = val
+		}
+	}
+}
+
 func (fp *ForecastPerson) setRoles(roles []interface{}) {
 	fp.roles = roles
 }
@@ -92,43 +105,209 @@ func (fp *ForecastPerson) setEvent(event justworks.Event) {
 	fp.event = event
 }
 
-func CreateProjectAssignmentForecast(forecastPeople []ForecastPerson, envVars map[string]string) {
+// PersonOffice picks the holiday calendar for a person from their Forecast
+// roles.
+func PersonOffice(fp ForecastPerson, config environment.HolidaysConfig) string {
+	for _, role := range fp.roles {
+		if roleName, ok := role.(string); ok {
+			if office, ok := config.OfficeRoles[roleName]; ok {
+				return office
+			}
+		}
+	}
+	return config.DefaultOffice
+}
+
+// WorkingCalendar combines the person's Forecast working days with their
+// office's holidays.
+func WorkingCalendar(fp ForecastPerson, config environment.HolidaysConfig, calendar *holidays.Calendar) workcal.Calendar {
+	return workcal.New(fp.workingDays, PersonOffice(fp, config), calendar)
+}
+
+// CalendarForEvents looks up whose event it is to use their working calendar,
+// falling back to a Monday to Friday week in the default office.
+func CalendarForEvents(forecastPeople []ForecastPerson, config environment.HolidaysConfig, calendar *holidays.Calendar) justworks.CalendarFor {
+	return func(ev justworks.Event) workcal.Calendar {
+		for _, fp := range forecastPeople {
+			if matchesEvent(fp, ev) {
+				return WorkingCalendar(fp, config, calendar)
+			}
+		}
+		return workcal.Default(config.DefaultOffice, calendar)
+	}
+}
+
+// PersonForEvents names the person an event belongs to with their Forecast
+// full name and email, or the "First L." and attendee email on the event
+// for people who aren't in Forecast.
+func PersonForEvents(forecastPeople []ForecastPerson) func(ev justworks.Event) (string, string) {
+	return func(ev justworks.Event) (string, string) {
+		for _, fp := range forecastPeople {
+			if matchesEvent(fp, ev) {
+				return fp.FullName(), strings.ToLower(fp.Email())
+			}
+		}
+		if emails := ev.Emails(); len(emails) > 0 {
+			return ev.Name(), emails[0]
+		}
+		return ev.Name(), ""
+	}
+}
+
+func (fp ForecastPerson) ID() int {
+	return fp.id
+}
+
+func (fp ForecastPerson) Email() string {
+	return fp.email
+}
+
+func (fp ForecastPerson) HarvestUserID() int {
+	return fp.harvesUserID
+}
+
+func (fp ForecastPerson) FirstName() string {
+	return fp.firstName
+}
+
+func (fp ForecastPerson) FullName() string {
+	return fmt.Sprintf("%s %s", fp.firstName, fp.lastName)
+}
+
+func (fp ForecastPerson) IsActive() bool {
+	return fp.login == "enabled" && !fp.archived
+}
+
+func (fp ForecastPerson) RoleNames() []string {
+	var roleNames []string
+	for _, role := range fp.roles {
+		if roleName, ok := role.(string); ok {
+			roleNames = append(roleNames, roleName)
+		}
+	}
+	return roleNames
+}
+
+// TimeOffProject picks the Forecast project to book someone's leave on, by
+// leave type, then by role, then the default time off project.
+func TimeOffProject(fp ForecastPerson, ev justworks.Event, config environment.ForecastConfig) string {
+	if projectID, ok := config.TimeOffProjectsByLeaveType[ev.EventType()]; ok {
+		return projectID
+	}
+	if projectID, ok := config.TimeOffProjectsByLeaveType[ev.DisplayType()]; ok {
+		return projectID
+	}
+	for _, role := range fp.RoleNames() {
+		if projectID, ok := config.TimeOffProjectsByRole[role]; ok {
+			return projectID
+		}
+	}
+	return config.TimeOffProjectID
+}
+
+// assignmentRequest is the body of POST /assignments. Allocation is seconds
+// per day, nil books the whole day. Time off is always for a person, so
+// PlaceholderID stays nil.
+type assignmentRequest struct {
+	StartDate               string  `json:"start_date"`
+	EndDate                 string  `json:"end_date"`
+	Allocation              *int    `json:"allocation"`
+	ActiveOnDaysOff         bool    `json:"active_on_days_off"`
+	RepeatedAssignmentSetID *int    `json:"repeated_assignment_set_id"`
+	ProjectID               string  `json:"project_id"`
+	PersonID                *string `json:"person_id"`
+	PlaceholderID           *string `json:"placeholder_id"`
+}
+
+func createAssignment(client *http.Client, config *environment.Config, fp ForecastPerson, start time.Time, end time.Time) {
 	dateLayout := "2006-01-02"
-	assignmentURL := fmt.Sprintf("%s/assignments", envVars["ForeCastApiUrl"])
+	assignmentURL := fmt.Sprintf("%s/assignments", config.Forecast.APIURL)
+
+	personID := fmt.Sprintf("%d", fp.id)
+	assignment := assignmentRequest{
+		StartDate: start.Format(dateLayout),
+		EndDate:   end.Format(dateLayout),
+		ProjectID: TimeOffProject(fp, fp.event, config.Forecast),
+		PersonID:  &personID,
+	}
+	if fp.event.IsPartialDay() {
+		allocation := int(fp.event.HoursPerDay() * 3600)
+		assignment.Allocation = &allocation
+	}
+	jsonStr, err := json.Marshal(map[string]assignmentRequest{"assignment": assignment})
+	if err != nil {
+		fmt.Println("Error in Forecast Assignment", err)
+		return
+	}
+	req, _ := http.NewRequest("POST", assignmentURL, bytes.NewBuffer(jsonStr))
+	req.Header.Add("authorization", fmt.Sprintf("Bearer %s", config.Forecast.Token.Value()))
+	req.Header.Add("forecast-account-id", config.Forecast.AccountID)
+	req.Header.Add("content-type", "application/json; charset=UTF-8")
+	fmt.Println("Requesting Forecast!!", assignmentURL, string(jsonStr))
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Println("Error in Forecast Assignment", err)
+		return
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	fmt.Println("Assignment Response", fp.email, string(body))
+}
+
+func CreateProjectAssignmentForecast(forecastPeople []ForecastPerson, config *environment.Config, calendar *holidays.Calendar) {
 	client := &http.Client{}
 	for _, fp := range forecastPeople {
-		endDate := fp.event.EndDate()
-		if int(endDate.Weekday()) == 0 {
-			endDate = endDate.Add(time.Duration(-2 * 24 * time.Hour))
-		} else if int(endDate.Weekday()) == 6 {
-			endDate = endDate.Add(time.Duration(-1 * 24 * time.Hour))
-		}
-		var jsonStr = []byte(fmt.Sprintf(`{"assignment":{"start_date":"%s","end_date":"%s","allocation":null,"active_on_days_off":false,
-										 "repeated_assignment_set_id":null, "project_id":"%s","person_id":"%d","placeholder_id":null}}`,
-			fp.event.StartDate().Format(dateLayout), endDate.Format(dateLayout), envVars["ForeCastApiTimeOffProjectID"], fp.id))
-		req, _ := http.NewRequest("POST", assignmentURL, bytes.NewBuffer(jsonStr))
-		req.Header.Add("authorization", fmt.Sprintf("Bearer %s", envVars["ForeCastApiToken"]))
-		req.Header.Add("forecast-account-id", envVars["ForeCastApiAccountId"])
-		req.Header.Add("content-type", "application/json; charset=UTF-8")
-		fmt.Println("Requesting Forecast!!", req)
-		resp, err := client.Do(req)
-		if err != nil {
-			fmt.Println("Error in Forecast Assignment", err)
-		}
-		defer resp.Body.Close()
-		body, err := ioutil.ReadAll(resp.Body)
-		fmt.Println("Assignment Response", fp.email, string(body))
-	}
-}
-
-func FilterForcastPeople(forcastPeople []ForecastPerson, filteredEvents []justworks.Event) ([]ForecastPerson, error) {
+		workingCalendar := WorkingCalendar(fp, config.Holidays, calendar)
+		ranges := workingCalendar.BookingRanges(fp.event.StartDate(), fp.event.LastDay())
+		fmt.Println("Booking", fp.email, workingCalendar.BusinessDays(fp.event.StartDate(), fp.event.LastDay()), "business days")
+		for _, dates := range ranges {
+			createAssignment(client, config, fp, dates[0], dates[1])
+		}
+	}
+}
+
+func EventsForPerson(fp ForecastPerson, events []justworks.Event) []justworks.Event {
+	var personEvents []justworks.Event
+	for _, ev := range events {
+		if matchesEvent(fp, ev) {
+			personEvents = append(personEvents, ev)
+		}
+	}
+	return personEvents
+}
+
+// matchesEvent uses the attendee emails on the event, and the "First L."
+// name Justworks puts in the summary only for events without them, so two
+// people with the same name and initial don't get each other's leave.
+func matchesEvent(fp ForecastPerson, ev justworks.Event) bool {
+	if len(ev.Emails()) > 0 {
+		return ev.HasEmail(fp.email)
+	}
+	if len(fp.firstName) == 0 || len(fp.lastName) == 0 {
+		return false
+	}
+	fpName := fmt.Sprintf("%s %c.", fp.firstName, fp.lastName[0])
+	return fpName == ev.Name()
+}
+
+// BookedLeaveType says whether a leave type is booked in Forecast: vacation
+// and casual leave always are, other types once they have a project.
+func BookedLeaveType(ev justworks.Event, config environment.ForecastConfig) bool {
+	if ev.EventType() == justworks.Vacation || ev.EventType() == justworks.CasualLeave {
+		return true
+	}
+	_, ok := config.TimeOffProjectsByLeaveType[ev.EventType()]
+	if !ok {
+		_, ok = config.TimeOffProjectsByLeaveType[ev.DisplayType()]
+	}
+	return ok
+}
+
+func FilterForcastPeople(forcastPeople []ForecastPerson, filteredEvents []justworks.Event, config environment.ForecastConfig) ([]ForecastPerson, error) {
 	var filteredForecastPeople []ForecastPerson
-	vacation := "Vacation"
-	casualLeave := "Casual Leave - Noida Team Only"
 	for _, ev := range filteredEvents {
 		for _, fp := range forcastPeople {
-			fpName := fmt.Sprintf("%s %c.", fp.firstName, fp.lastName[0])
-			if (fpName == ev.Name()) && ((ev.EventType() == vacation) || (ev.EventType() == casualLeave)) {
+			if matchesEvent(fp, ev) && BookedLeaveType(ev, config) {
 				fp.setEvent(ev)
 				filteredForecastPeople = append(filteredForecastPeople, fp)
 			}
@@ -142,10 +321,9 @@ func FilterEventsForProductAndAccountsPeople(forcastPeople []ForecastPerson, eve
 	var otherEvents []justworks.Event
 	for _, ev := range events {
 		for _, fp := range forcastPeople {
-			fpName := fmt.Sprintf("%s %c.", fp.firstName, fp.lastName[0])
-			if fpName == ev.Name() {
+			if matchesEvent(fp, ev) {
 				fp.setEvent(ev)
-				if CheckProductOrAccountPerson(fp) == true && fpName == ev.Name() {
+				if CheckProductOrAccountPerson(fp) == true {
 					productAndAccountsEvents = append(productAndAccountsEvents, ev)
 				} else {
 					otherEvents = append(otherEvents, ev)
@@ -156,27 +334,38 @@ func FilterEventsForProductAndAccountsPeople(forcastPeople []ForecastPerson, eve
 	return productAndAccountsEvents, otherEvents, nil
 }
 
-func GetPeopleDetailsFromForecast(envVars map[string]string) ([]ForecastPerson, error) {
+var tokenRemediation = "Log in to Forecast from a browser, copy the authorization token from a request in the web inspector and set it in ForeCastApiToken."
+
+func GetPeopleDetailsFromForecast(config *environment.Config, alerter alert.Alerter) ([]ForecastPerson, error) {
 	var forcastPeople []ForecastPerson
 
-	peopleURL := fmt.Sprintf("%s/people", envVars["ForeCastApiUrl"])
+	peopleURL := fmt.Sprintf("%s/people", config.Forecast.APIURL)
 	client := &http.Client{}
 	req, _ := http.NewRequest("GET", peopleURL, nil)
-	req.Header.Add("authorization", fmt.Sprintf("Bearer %s", envVars["ForeCastApiToken"]))
-	req.Header.Add("forecast-account-id", envVars["ForeCastApiAccountId"])
+	req.Header.Add("authorization", fmt.Sprintf("Bearer %s", config.Forecast.Token.Value()))
+	req.Header.Add("forecast-account-id", config.Forecast.AccountID)
 
 	resp, err := client.Do(req)
 	if err != nil {
 		fmt.Println("Error in fetching Forecast People", err)
-		emailSubject := "Error in Forecast Integration"
-		emailBody := fmt.Sprintf("Error in fetching data from Forecast: %s", err)
-		ses.SendEmailSMTP(envVars["DefaultFromEmail"], envVars["AdminEmail"], emailSubject, emailBody, envVars)
+		alerter.Send(alert.Alert{
+			Key:         "forecast-unreachable",
+			Severity:    alert.Warning,
+			Subject:     "Error in Forecast Integration",
+			Message:     fmt.Sprintf("Error in fetching data from Forecast: %s", err),
+			Remediation: "Check that ForeCastApiUrl is reachable, the next run will retry.",
+		})
 		return forcastPeople, nil
 	}
 	if resp.StatusCode == 401 {
-		emailSubject := "Error in Forecast Integration"
-		emailBody := fmt.Sprintf("Forecast token expired: %s", http.StatusText(resp.StatusCode))
-		ses.SendEmailSMTP(envVars["DefaultFromEmail"], envVars["AdminEmail"], emailSubject, emailBody, envVars)
+		resp.Body.Close()
+		alerter.Send(alert.Alert{
+			Key:         "forecast-token-expired",
+			Severity:    alert.Critical,
+			Subject:     "Error in Forecast Integration",
+			Message:     fmt.Sprintf("Forecast token expired: %s", http.StatusText(resp.StatusCode)),
+			Remediation: tokenRemediation,
+		})
 		return forcastPeople, nil
 	}
 	fmt.Println("Forecast People")
@@ -188,6 +377,10 @@ func GetPeopleDetailsFromForecast(envVars map[string]string) ([]ForecastPerson,
 		person := ForecastPerson{
 			id: int(raw["people"][index]["id"].(float64)),
 		}
+		workingDays := raw["people"][index]["working_days"]
+		if workingDays != nil {
+			person.setWorkingDays(workingDays.(map[string]interface{}))
+		}
 		roles := raw["people"][index]["roles"]
 		if roles != nil {
 			person.setRoles(roles.([]interface{}))
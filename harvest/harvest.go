@@ -0,0 +1,110 @@
+package harvest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/environment"
+)
+
+const dateLayout = "2006-01-02"
+
+type TimeEntry struct {
+	ID        int     `json:"id"`
+	SpentDate string  `json:"spent_date"`
+	Hours     float64 `json:"hours"`
+	Notes     string  `json:"notes"`
+}
+
+// Client talks to the Harvest v2 API.
+type Client struct {
+	config environment.HarvestConfig
+	http   *http.Client
+}
+
+func New(config environment.HarvestConfig) Client {
+	return Client{config: config, http: &http.Client{}}
+}
+
+func (c Client) do(method string, path string, params url.Values, payload interface{}, result interface{}) error {
+	requestURL := fmt.Sprintf("%s/%s", c.config.APIURL, path)
+	if len(params) > 0 {
+		requestURL = fmt.Sprintf("%s?%s", requestURL, params.Encode())
+	}
+	var body []byte
+	if payload != nil {
+		var err error
+		body, err = json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, requestURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("authorization", fmt.Sprintf("Bearer %s", c.config.Token.Value()))
+	req.Header.Add("harvest-account-id", c.config.AccountID)
+	req.Header.Add("user-agent", "BootBot Justworks Integration")
+	req.Header.Add("content-type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Harvest %s %s: %s %s", method, path, resp.Status, string(respBody))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, result)
+}
+
+// TimeOffEntries lists a user's entries on the time off task from from to
+// to, both included, going through every page.
+func (c Client) TimeOffEntries(userID int, from time.Time, to time.Time) ([]TimeEntry, error) {
+	var entries []TimeEntry
+	params := url.Values{
+		"user_id":    {fmt.Sprintf("%d", userID)},
+		"project_id": {fmt.Sprintf("%d", c.config.TimeOffProjectID)},
+		"task_id":    {fmt.Sprintf("%d", c.config.TimeOffTaskID)},
+		"from":       {from.Format(dateLayout)},
+		"to":         {to.Format(dateLayout)},
+		"per_page":   {"100"},
+	}
+	for page := 1; page > 0; {
+		params.Set("page", fmt.Sprintf("%d", page))
+		var raw struct {
+			TimeEntries []TimeEntry `json:"time_entries"`
+			NextPage    int         `json:"next_page"`
+		}
+		if err := c.do("GET", "time_entries", params, nil, &raw); err != nil {
+			return entries, err
+		}
+		entries = append(entries, raw.TimeEntries...)
+		page = raw.NextPage
+	}
+	return entries, nil
+}
+
+func (c Client) CreateTimeOffEntry(userID int, date time.Time, hours float64, notes string) error {
+	return c.do("POST", "time_entries", nil, map[string]interface{}{
+		"user_id":    userID,
+		"project_id": c.config.TimeOffProjectID,
+		"task_id":    c.config.TimeOffTaskID,
+		"spent_date": date.Format(dateLayout),
+		"hours":      hours,
+		"notes":      notes,
+	}, nil)
+}
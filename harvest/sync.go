@@ -0,0 +1,137 @@
+package harvest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/environment"
+	"github.com/jainmickey/justworks_integration/forecast"
+	"github.com/jainmickey/justworks_integration/holidays"
+	"github.com/jainmickey/justworks_integration/justworks"
+	"github.com/jainmickey/justworks_integration/workcal"
+)
+
+// Difference is a day where Justworks and Harvest disagree on how many
+// hours someone was off.
+type Difference struct {
+	Person    string
+	Date      time.Time
+	Justworks float64
+	Harvest   float64
+}
+
+// expectedHours is the time off per working day from Justworks, for the
+// leave types that are booked in Forecast too.
+func expectedHours(fp forecast.ForecastPerson, events []justworks.Event, config *environment.Config, calendar *holidays.Calendar, from time.Time, to time.Time) map[string]float64 {
+	var booked []justworks.Event
+	for _, ev := range forecast.EventsForPerson(fp, events) {
+		if forecast.BookedLeaveType(ev, config.Forecast) {
+			booked = append(booked, ev)
+		}
+	}
+	workingCalendar := forecast.WorkingCalendar(fp, config.Holidays, calendar)
+
+	hours := map[string]float64{}
+	for date := workcal.Day(from); !date.After(to); date = date.AddDate(0, 0, 1) {
+		if !workingCalendar.IsWorkingDay(date) {
+			continue
+		}
+		if out := justworks.OutOn(booked, date); out > 0 {
+			hours[date.Format(dateLayout)] = out * justworks.WorkingHoursPerDay
+		}
+	}
+	return hours
+}
+
+func loggedHours(entries []TimeEntry) map[string]float64 {
+	hours := map[string]float64{}
+	for _, entry := range entries {
+		hours[entry.SpentDate] += entry.Hours
+	}
+	return hours
+}
+
+// SyncTimeOff creates a time off entry for every day of leave from from to
+// to (both included) that has nothing logged on the time off task yet, so
+// running it again never doubles an entry.
+func SyncTimeOff(forecastPeople []forecast.ForecastPerson, events []justworks.Event, config *environment.Config, calendar *holidays.Calendar, from time.Time, to time.Time) {
+	client := New(config.Harvest)
+	for _, fp := range forecastPeople {
+		if !fp.IsActive() || fp.HarvestUserID() == 0 {
+			continue
+		}
+		expected := expectedHours(fp, events, config, calendar, from, to)
+		if len(expected) == 0 {
+			continue
+		}
+		entries, err := client.TimeOffEntries(fp.HarvestUserID(), from, to)
+		if err != nil {
+			fmt.Println("Error in fetching Harvest time entries", fp.Email(), err)
+			continue
+		}
+		logged := loggedHours(entries)
+		for date, hours := range expected {
+			if logged[date] > 0 {
+				continue
+			}
+			spentDate, _ := time.Parse(dateLayout, date)
+			fmt.Println("Logging Harvest time off", fp.Email(), date, hours)
+			if err := client.CreateTimeOffEntry(fp.HarvestUserID(), spentDate, hours, "Time off from Justworks"); err != nil {
+				fmt.Println("Error in Harvest time entry", fp.Email(), err)
+			}
+		}
+	}
+}
+
+// Differences compares the Justworks PTO with the Harvest time off hours
+// of everyone with a Harvest user, day by day.
+func Differences(forecastPeople []forecast.ForecastPerson, events []justworks.Event, config *environment.Config, calendar *holidays.Calendar, from time.Time, to time.Time) ([]Difference, error) {
+	client := New(config.Harvest)
+	var differences []Difference
+	for _, fp := range forecastPeople {
+		if !fp.IsActive() || fp.HarvestUserID() == 0 {
+			continue
+		}
+		entries, err := client.TimeOffEntries(fp.HarvestUserID(), from, to)
+		if err != nil {
+			return differences, err
+		}
+		expected := expectedHours(fp, events, config, calendar, from, to)
+		logged := loggedHours(entries)
+		dates := map[string]bool{}
+		for date := range expected {
+			dates[date] = true
+		}
+		for date := range logged {
+			dates[date] = true
+		}
+		for date := range dates {
+			if math.Abs(expected[date]-logged[date]) < 0.01 {
+				continue
+			}
+			spentDate, _ := time.Parse(dateLayout, date)
+			differences = append(differences, Difference{Person: fp.FullName(), Date: spentDate, Justworks: expected[date], Harvest: logged[date]})
+		}
+	}
+	sort.Slice(differences, func(i, j int) bool {
+		if differences[i].Person != differences[j].Person {
+			return differences[i].Person < differences[j].Person
+		}
+		return differences[i].Date.Before(differences[j].Date)
+	})
+	return differences, nil
+}
+
+func CreateDifferencesMessage(differences []Difference, from time.Time, to time.Time) string {
+	messaging := fmt.Sprintf(":mag: *Justworks vs Harvest time off %s – %s*:\n\n", from.Format("2 Jan 2006"), to.Format("2 Jan 2006"))
+	if len(differences) == 0 {
+		return fmt.Sprintf("%sEverything matches.\n", messaging)
+	}
+	for _, difference := range differences {
+		messaging = fmt.Sprintf("%s- %s, %s: Justworks %gh, Harvest %gh\n", messaging,
+			difference.Person, difference.Date.Format("Mon 2 Jan"), difference.Justworks, difference.Harvest)
+	}
+	return messaging
+}
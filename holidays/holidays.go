@@ -0,0 +1,167 @@
+package holidays
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/environment"
+	"github.com/lestrrat-go/ical"
+	"gopkg.in/yaml.v2"
+)
+
+const dateLayout = "2006-01-02"
+
+type Holiday struct {
+	Date   time.Time
+	Name   string
+	Office string
+}
+
+// Calendar holds the public holidays of every office, keyed by date.
+type Calendar struct {
+	offices map[string]map[string]Holiday
+}
+
+type yamlHolidays struct {
+	Office   string `yaml:"office"`
+	Holidays []struct {
+		Date string `yaml:"date"`
+		Name string `yaml:"name"`
+	} `yaml:"holidays"`
+}
+
+func dateKey(t time.Time) string {
+	return t.Format(dateLayout)
+}
+
+func loadYAML(office string, filename string) ([]Holiday, error) {
+	var holidaysList []Holiday
+	file, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return holidaysList, err
+	}
+	var raw yamlHolidays
+	err = yaml.Unmarshal(file, &raw)
+	if err != nil {
+		return holidaysList, err
+	}
+	for _, item := range raw.Holidays {
+		date, err := time.Parse(dateLayout, item.Date)
+		if err != nil {
+			return holidaysList, fmt.Errorf("%s: bad date %q for %s", filename, item.Date, item.Name)
+		}
+		holidaysList = append(holidaysList, Holiday{Date: date, Name: item.Name, Office: office})
+	}
+	return holidaysList, nil
+}
+
+func loadICS(office string, filename string) ([]Holiday, error) {
+	var holidaysList []Holiday
+	p := ical.NewParser()
+	c, err := p.ParseFile(filename)
+	if err != nil {
+		return holidaysList, err
+	}
+	for e := range c.Entries() {
+		ev, ok := e.(*ical.Event)
+		if !ok {
+			continue
+		}
+		summary, ok := ev.GetProperty("summary")
+		if !ok {
+			continue
+		}
+		dtstart, ok := ev.GetProperty("dtstart")
+		if !ok {
+			continue
+		}
+		value := dtstart.RawValue()
+		if len(value) < 8 {
+			continue
+		}
+		date, err := time.Parse("20060102", value[:8])
+		if err != nil {
+			fmt.Println("Error in holiday date", filename, value, err)
+			continue
+		}
+		holidaysList = append(holidaysList, Holiday{Date: date, Name: summary.RawValue(), Office: office})
+	}
+	return holidaysList, nil
+}
+
+// Load reads each office's holidays from a .ics or .yaml file.
+func Load(config environment.HolidaysConfig) (*Calendar, error) {
+	calendar := &Calendar{offices: map[string]map[string]Holiday{}}
+	for office, filename := range config.Files {
+		var holidaysList []Holiday
+		var err error
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".ics":
+			holidaysList, err = loadICS(office, filename)
+		case ".yaml", ".yml":
+			holidaysList, err = loadYAML(office, filename)
+		default:
+			err = fmt.Errorf("unknown holiday file type %s", filename)
+		}
+		if err != nil {
+			return calendar, fmt.Errorf("Can't load %s holidays: %s", office, err.Error())
+		}
+		calendar.offices[office] = map[string]Holiday{}
+		for _, holiday := range holidaysList {
+			calendar.offices[office][dateKey(holiday.Date)] = holiday
+		}
+		fmt.Println("Loaded holidays", office, len(holidaysList))
+	}
+	return calendar, nil
+}
+
+func (c *Calendar) Offices() []string {
+	var offices []string
+	if c == nil {
+		return offices
+	}
+	for office := range c.offices {
+		offices = append(offices, office)
+	}
+	sort.Strings(offices)
+	return offices
+}
+
+func (c *Calendar) IsHoliday(office string, date time.Time) (Holiday, bool) {
+	if c == nil {
+		return Holiday{}, false
+	}
+	holiday, ok := c.offices[office][dateKey(date)]
+	return holiday, ok
+}
+
+// Between lists the holidays of one office, or of every office when office
+// is empty, from start up to but not including end.
+func (c *Calendar) Between(office string, start time.Time, end time.Time) []Holiday {
+	var holidaysList []Holiday
+	if c == nil {
+		return holidaysList
+	}
+	from, to := dateKey(start), dateKey(end)
+	for name, days := range c.offices {
+		if len(office) > 0 && name != office {
+			continue
+		}
+		for key, holiday := range days {
+			if key >= from && key < to {
+				holidaysList = append(holidaysList, holiday)
+			}
+		}
+	}
+	sort.Slice(holidaysList, func(i, j int) bool {
+		if holidaysList[i].Date.Equal(holidaysList[j].Date) {
+			return holidaysList[i].Office < holidaysList[j].Office
+		}
+		return holidaysList[i].Date.Before(holidaysList[j].Date)
+	})
+	return holidaysList
+}
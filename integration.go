@@ -1,55 +1,34 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/jainmickey/justworks_integration/alert"
+	"github.com/jainmickey/justworks_integration/capacity"
+	"github.com/jainmickey/justworks_integration/coverage"
 	"github.com/jainmickey/justworks_integration/environment"
+	"github.com/jainmickey/justworks_integration/feeds"
 	"github.com/jainmickey/justworks_integration/forecast"
+	"github.com/jainmickey/justworks_integration/harvest"
+	"github.com/jainmickey/justworks_integration/holidays"
 	"github.com/jainmickey/justworks_integration/justworks"
-	"github.com/jainmickey/justworks_integration/s3"
+	"github.com/jainmickey/justworks_integration/reminders"
 	"github.com/jainmickey/justworks_integration/slacknotifier"
+	"github.com/jainmickey/justworks_integration/state"
+	"github.com/jainmickey/justworks_integration/status"
+	"github.com/jainmickey/justworks_integration/subscriptions"
+	"github.com/jainmickey/justworks_integration/webhooks"
+	"github.com/jainmickey/justworks_integration/workcal"
 
 	"github.com/aws/aws-lambda-go/lambda"
 )
 
-type GlobalState struct {
-	DailyRunTime time.Time `json:"daily_run_time"`
-	// WeeklyRunTime time.Time `json:"weekly_run_time"`
-}
-
-func readGlobalStateFile(filename string) (GlobalState, error) {
-	file, _ := ioutil.ReadFile(filename)
-
-	data := GlobalState{}
-	var rawStrings map[string]string
-
-	err := json.Unmarshal([]byte(file), &rawStrings)
-	if err != nil {
-		fmt.Println("Error in json unmarshell error: ", err)
-		return data, err
-	}
+const dailyRunTimeKey = "daily_run_time"
 
-	dailyTime, err := time.Parse(time.RFC3339, rawStrings["daily_run_time"])
-	if err != nil {
-		fmt.Println("Error in time parsing: ", err)
-		return data, err
-	}
-	data.DailyRunTime = dailyTime
-
-	// ----- Comment out weekly code -----------------------
-	// weeklyTime, err := time.Parse(time.RFC3339, rawStrings["weekly_run_time"])
-	// if err != nil {
-	// 	fmt.Println("Error in time parsing: ", err)
-	// 	return data, err
-	// }
-	// data.WeeklyRunTime = weeklyTime
-
-	fmt.Println("Time", data.DailyRunTime) // , data.WeeklyRunTime)
-	return data, nil
-}
+// const weeklyRunTimeKey = "weekly_run_time"
 
 func getDateRange() (time.Time, time.Time) {
 	start := time.Now()
@@ -61,27 +40,42 @@ func getDateRange() (time.Time, time.Time) {
 	return start, end
 }
 
-func weeklySlackMessage(envVars map[string]string) {
+func weeklySlackMessage(config *environment.Config, calendar *holidays.Calendar) {
 	start, end := getDateRange()
 	fmt.Println("Start End", start, end)
-	eventsList, _ := justworks.GetByDateRange(start, end, envVars)
+	eventsList, _ := justworks.GetByDateRange(start, end, config)
 	eventsList, _ = justworks.FilterEventsForVacationAndRemote(eventsList)
 
 	// --- Bool specify its for product accounts people or not and upcoming message or not -----------
 	sortedEventsList, _ := justworks.SortCalenderItems(eventsList, false, false)
-	message, _ := justworks.CreateEventMessage(sortedEventsList)
+	message, _ := justworks.CreateEventMessage(sortedEventsList, workcal.Default(config.Holidays.DigestOffice, calendar))
+	holidaysMessage, _ := justworks.CreateHolidaysMessage(calendar.Between("", start, end.Add(24*time.Hour)))
+	message = fmt.Sprintf("%s\n%s", message, holidaysMessage)
 	fmt.Println("Final Message", message)
-	slackConn := slacknotifier.New(envVars["SlackWebhookURL"])
+	if config.Slack.Enabled == false || len(config.Slack.WebhookURL) == 0 {
+		return
+	}
+	slackConn := slacknotifier.New(config.Slack.WebhookURL.Value())
 	slackConn.Notify(message)
 }
 
-func dailyProductAccountsSlackMessage(envVars map[string]string) {
-	eventsList, _ := justworks.GetTodaysEvents(envVars)
-	upcomingEventsList, _ := justworks.GetUpcomingEvents(envVars)
+func dailyProductAccountsSlackMessage(config *environment.Config, store *state.Store, alerter alert.Alerter, calendar *holidays.Calendar) {
+	if holiday, ok := calendar.IsHoliday(config.Holidays.DigestOffice, time.Now()); ok {
+		fmt.Println("No digest on a holiday", holiday.Name)
+		return
+	}
+
+	eventsList, _ := justworks.GetTodaysEvents(config)
+	upcomingEventsList, _ := justworks.GetUpcomingEvents(config)
 	eventsList, _ = justworks.FilterEventsForVacationAndRemote(eventsList)
 	upcomingEventsList, _ = justworks.FilterEventsForVacationAndRemote(upcomingEventsList)
-	forecastPeople, _ := forecast.GetPeopleDetailsFromForecast(envVars)
-	eventsList, _, _ = forecast.FilterEventsForProductAndAccountsPeople(forecastPeople, eventsList)
+	// --------- Without Forecast there are no roles, so the whole team is listed ---------------------
+	var forecastPeople []forecast.ForecastPerson
+	if config.Forecast.Enabled {
+		forecastPeople, _ = forecast.GetPeopleDetailsFromForecast(config, alerter)
+		eventsList, _, _ = forecast.FilterEventsForProductAndAccountsPeople(forecastPeople, eventsList)
+	}
+	calendarFor := forecast.CalendarForEvents(forecastPeople, config.Holidays, calendar)
 
 	// --------- Upcoming is for whole team ----------------------------------------------------------
 	// --- Bool specify its for product accounts people or not and upcoming message or not -----------
@@ -89,81 +83,246 @@ func dailyProductAccountsSlackMessage(envVars map[string]string) {
 	upcomingSortedEventsList, _ := justworks.SortCalenderItems(upcomingEventsList, false, true)
 
 	// --------- Bool specify its upcoming message or not -----------------------
-	message, _ := justworks.CreateProductAndAccountMessage(sortedEventsList, false)
-	upcominEventsMessage, _ := justworks.CreateProductAndAccountMessage(upcomingSortedEventsList, true)
-	finalMessage := fmt.Sprintf("\n%s\n\n%s", message, upcominEventsMessage)
+	message, _ := justworks.CreateProductAndAccountMessage(sortedEventsList, false, calendarFor)
+	upcominEventsMessage, _ := justworks.CreateProductAndAccountMessage(upcomingSortedEventsList, true, calendarFor)
+	upcomingStart, upcomingEnd := justworks.UpcomingDateRange()
+	holidaysMessage, _ := justworks.CreateHolidaysMessage(calendar.Between("", upcomingStart, upcomingEnd))
+	finalMessage := fmt.Sprintf("\n%s\n\n%s%s", message, upcominEventsMessage, holidaysMessage)
+
+	// --------- Changes go in their own channel when one is configured ---------------------------------
+	changesMessage := ""
+	changes, _ := justworks.GetChangesSinceLastRun(store)
+	if changes.Empty() == false {
+		changesMessage, _ = justworks.CreateChangesMessage(changes)
+		if len(config.Slack.ChangesWebhookURL) == 0 {
+			finalMessage = fmt.Sprintf("%s\n\n%s", finalMessage, changesMessage)
+			changesMessage = ""
+		}
+	}
+	if config.Webhooks.Enabled {
+		webhooks.Emit(changes, config, store, alerter)
+	}
+	if config.Subscriptions.Enabled {
+		subscriptions.NotifyFollowers(config, store, forecastPeople, changes)
+	}
 	fmt.Println("Final Message", finalMessage)
-	slackConn := slacknotifier.New(envVars["ProductAndAccountSlackWebhookURL"])
-	slackConn.Notify(finalMessage)
+	if config.Slack.Enabled == false {
+		return
+	}
+	slackConn := slacknotifier.New(config.Slack.ProductAndAccountWebhookURL.Value())
+	if config.Slack.DigestButtons {
+		slackConn.NotifyMessage(subscriptions.DigestMessage(finalMessage, false))
+	} else {
+		slackConn.Notify(finalMessage)
+	}
+	if len(config.Slack.BotToken) > 0 {
+		subscriptions.SendDigestDMs(slacknotifier.NewClient(config.Slack.BotToken.Value()), store, finalMessage)
+	}
+	if len(changesMessage) > 0 {
+		changesConn := slacknotifier.New(config.Slack.ChangesWebhookURL.Value())
+		changesConn.Notify(changesMessage)
+	}
 }
 
-func dailyForecast(envVars map[string]string) {
+func dailyForecast(config *environment.Config, alerter alert.Alerter, calendar *holidays.Calendar) {
 	start := time.Now()
 	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
 
-	eventsList, _ := justworks.GetByStartDate(start, envVars)
+	eventsList, _ := justworks.GetByStartDate(start, config)
 	eventsList, _ = justworks.FilterEventsForVacation(eventsList)
-	forecastPeople, _ := forecast.GetPeopleDetailsFromForecast(envVars)
-	forecastPeople, _ = forecast.FilterForcastPeople(forecastPeople, eventsList)
-	forecast.CreateProjectAssignmentForecast(forecastPeople, envVars)
+	forecastPeople, _ := forecast.GetPeopleDetailsFromForecast(config, alerter)
+	forecastPeople, _ = forecast.FilterForcastPeople(forecastPeople, eventsList, config.Forecast)
+	forecast.CreateProjectAssignmentForecast(forecastPeople, config, calendar)
+}
+
+func coverageWarnings(config *environment.Config, store *state.Store, alerter alert.Alerter, calendar *holidays.Calendar) {
+	start := time.Now()
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	end := start.AddDate(0, 0, config.Coverage.LookaheadDays+1)
+
+	eventsList, _ := justworks.GetOverlapping(start, end, config)
+	forecastPeople, _ := forecast.GetPeopleDetailsFromForecast(config, alerter)
+	members := capacity.Members(forecastPeople, eventsList, config.Holidays, calendar)
+	violations := coverage.Check(config.Coverage.Rules, members, start, end)
+	coverage.Notify(coverage.NewViolations(violations, store, start), config)
+}
+
+func harvestSync(config *environment.Config, alerter alert.Alerter, calendar *holidays.Calendar) {
+	today := time.Now()
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location())
+	from := today.AddDate(0, 0, -config.Harvest.DaysBack)
+	to := today.AddDate(0, 0, config.Harvest.DaysAhead)
+
+	eventsList, _ := justworks.GetOverlapping(from, to.AddDate(0, 0, 1), config)
+	forecastPeople, _ := forecast.GetPeopleDetailsFromForecast(config, alerter)
+	harvest.SyncTimeOff(forecastPeople, eventsList, config, calendar, from, to)
+}
+
+// publishFeeds publishes the last month and the next year of who's out.
+func publishFeeds(config *environment.Config, store *state.Store, alerter alert.Alerter) {
+	now := time.Now()
+	eventsList, _ := justworks.GetOverlapping(now.AddDate(0, -1, 0), now.AddDate(1, 0, 0), config)
+	eventsList, _ = justworks.FilterEventsForVacationAndRemote(eventsList)
+	var forecastPeople []forecast.ForecastPerson
+	if config.Forecast.Enabled {
+		forecastPeople, _ = forecast.GetPeopleDetailsFromForecast(config, alerter)
+	}
+
+	teamFeeds := feeds.BuildFeeds(forecastPeople, eventsList, config.Feeds)
+	feeds.PublishS3(teamFeeds, config, now)
+	if len(config.Feeds.CalDAVURL) > 0 {
+		feeds.PublishCalDAV(teamFeeds, config, store, now)
+	}
+}
+
+const conflictsSentKey = "conflicts_sent"
+
+func upcomingConflicts(config *environment.Config, alerter alert.Alerter, calendar *holidays.Calendar) []forecast.Conflict {
+	start := time.Now()
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	end := start.AddDate(0, 0, config.Conflicts.LookaheadDays)
+
+	eventsList, _ := justworks.GetOverlapping(start, end, config)
+	forecastPeople, _ := forecast.GetPeopleDetailsFromForecast(config, alerter)
+	assignments, err := forecast.GetAssignments(config, start, end.AddDate(0, 0, -1), 0)
+	if err != nil {
+		fmt.Println("Error in fetching Forecast assignments", err)
+		return nil
+	}
+	projects, err := forecast.GetProjects(config)
+	if err != nil {
+		fmt.Println("Error in fetching Forecast projects", err)
+		return nil
+	}
+	return forecast.FindConflicts(forecastPeople, eventsList, assignments, projects, config, calendar, start, end)
+}
+
+// projectConflicts tells each project manager about new conflicts, by
+// direct message when there's a bot token, and posts them all to the
+// conflicts channel.
+func projectConflicts(config *environment.Config, store *state.Store, alerter alert.Alerter, calendar *holidays.Calendar) {
+	sent := map[string]bool{}
+	store.Get(conflictsSentKey, &sent)
+	stillOn := map[string]bool{}
+	var fresh []forecast.Conflict
+	for _, conflict := range upcomingConflicts(config, alerter, calendar) {
+		// ---- Keyed by leave, not by the days left, so it's only sent once ----
+		isNew := false
+		for _, leave := range conflict.Leave {
+			key := fmt.Sprintf("%d|%s|%s", conflict.Project.ID, strings.ToLower(conflict.Email), leave)
+			stillOn[key] = true
+			isNew = isNew || !sent[key]
+		}
+		if isNew {
+			fresh = append(fresh, conflict)
+		}
+	}
+	store.Set(conflictsSentKey, stillOn)
+
+	managers, byManager := forecast.GroupByManager(fresh)
+	var messages []string
+	for _, manager := range managers {
+		message := forecast.CreateConflictsMessage(manager, byManager[manager])
+		fmt.Println("Conflicts Message", message)
+		messages = append(messages, message)
+		if config.Slack.Enabled == false || len(config.Slack.BotToken) == 0 || len(manager) == 0 {
+			continue
+		}
+		client := slacknotifier.NewClient(config.Slack.BotToken.Value())
+		if err := client.SendDirectMessage(manager, message); err != nil {
+			fmt.Println("Error in messaging project manager", manager, err)
+		}
+	}
+	if config.Slack.Enabled == false || len(config.Slack.ConflictsWebhookURL) == 0 || len(messages) == 0 {
+		return
+	}
+	slackConn := slacknotifier.New(config.Slack.ConflictsWebhookURL.Value())
+	slackConn.Notify(strings.Join(messages, "\n"))
 }
 
 func HandleLambdaEvent() (string, error) {
-	envVars, _ := environment.GetEnvironmentVars()
-	globalStateFile := "/tmp/globalState.json"
-	s3.DownloadFile(envVars["AWS_STORAGE_BUCKET_NAME"], globalStateFile)
-	globalData, err := readGlobalStateFile(globalStateFile)
-	dailyDuration := 0
+	config, err := environment.LoadConfig()
+	if err != nil {
+		fmt.Println(err)
+		return "", err
+	}
+	fmt.Printf("Config: %+v\n", *config)
+
+	store, err := state.Load(config.Storage.Bucket)
+	if err != nil {
+		fmt.Println(err)
+		return "", err
+	}
+	alerter := alert.New(config, store)
+	defer func() {
+		subscriptions.ReloadPreferences(store)
+		store.Save()
+	}()
+
+	calendar, err := holidays.Load(config.Holidays)
+	if err != nil {
+		fmt.Println("Error in loading holidays: ", err)
+	}
 
+	var dailyRunTime time.Time
 	// ---------- Comment out weekly message code --------------------
+	// var weeklyRunTime time.Time
 	// weeklyDuration := 0
-	if err != nil {
-		globalData.DailyRunTime = time.Now()
-		// globalData.WeeklyRunTime = time.Now()
-	} else {
-		dailyDuration = int(time.Now().Sub(globalData.DailyRunTime).Hours())
-		// weeklyDuration = int(time.Now().Sub(globalData.WeeklyRunTime).Hours())
+	if store.Get(dailyRunTimeKey, &dailyRunTime) {
+		dailyDuration := int(time.Now().Sub(dailyRunTime).Hours())
+		// store.Get(weeklyRunTimeKey, &weeklyRunTime)
+		// weeklyDuration = int(time.Now().Sub(weeklyRunTime).Hours())
 		fmt.Println("Duration", dailyDuration) // , weeklyDuration)
 		if dailyDuration < 23 {
 			fmt.Println("Ran Already!")
 			return "Ran Already!", nil
 		}
-
 	}
 
-	justworksFileStatus, err := justworks.DownloadJustWorksFile(envVars)
+	justworksFileStatus, err := justworks.DownloadJustWorksFile(config, store, alerter)
 	if justworksFileStatus == false {
 		fmt.Println("Error in fetching justworks file: ", err)
 	} else {
+		justworks.CheckFeedHealth(config, store, alerter)
+
 		// ---------- Comment out weekly message code --------------------
 		// if weeklyDuration == 0 || weeklyDuration > 150 {
-		// 	weeklySlackMessage(envVars)
-		// 	globalData.WeeklyRunTime = time.Now()
+		// 	weeklySlackMessage(config, calendar)
+		// 	store.Set(weeklyRunTimeKey, time.Now())
 		// }
-		dailyProductAccountsSlackMessage(envVars)
-		globalData.DailyRunTime = time.Now()
-
-		data := struct {
-			DailyRunTime string `json:"daily_run_time"`
-			// WeeklyRunTime string `json:"weekly_run_time"`
-		}{
-			DailyRunTime: globalData.DailyRunTime.Format(time.RFC3339),
-			// WeeklyRunTime: globalData.WeeklyRunTime.Format(time.RFC3339),
-		}
-		file, _ := json.Marshal(data)
-		_ = ioutil.WriteFile(globalStateFile, file, 0777)
+		dailyProductAccountsSlackMessage(config, store, alerter, calendar)
+		store.Set(dailyRunTimeKey, time.Now())
 
-		s3FileUploadStatus, err := s3.UploadFile(envVars["AWS_STORAGE_BUCKET_NAME"], globalStateFile)
-		if s3FileUploadStatus == false {
-			fmt.Println("Error in uploading s3 file: ", err)
+		if config.Feeds.Enabled {
+			publishFeeds(config, store, alerter)
 		}
 
-		dailyForecast(envVars)
+		if config.Forecast.Enabled {
+			dailyForecast(config, alerter, calendar)
+			if len(config.Coverage.Rules) > 0 {
+				coverageWarnings(config, store, alerter, calendar)
+			}
+			if config.Reminders.Enabled {
+				reminders.SendReminders(config, store, alerter, calendar)
+			}
+			if config.Status.Enabled {
+				status.SyncStatuses(config, store, alerter, calendar)
+			}
+			if config.Conflicts.Enabled {
+				projectConflicts(config, store, alerter, calendar)
+			}
+			if config.Harvest.Enabled {
+				harvestSync(config, alerter, calendar)
+			}
+		}
 	}
 	return "Executed Successfully!", nil
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
 	HandleLambdaEvent()
 	lambda.Start(HandleLambdaEvent)
 }
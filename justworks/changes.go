@@ -0,0 +1,170 @@
+package justworks
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/state"
+)
+
+const ptoSnapshotKey = "justworks_pto_snapshot"
+
+// SnapshotEvent is the part of an Event remembered between runs.
+type SnapshotEvent struct {
+	UID       string    `json:"uid"`
+	Name      string    `json:"name"`
+	EventType string    `json:"event_type"`
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+	Emails    []string  `json:"emails,omitempty"`
+}
+
+func (se SnapshotEvent) event() Event {
+	return Event{uid: se.UID, name: se.Name, eventType: se.EventType, startDate: se.StartDate, endDate: se.EndDate, attendees: se.Emails}
+}
+
+type EventChange struct {
+	Previous Event
+	Current  Event
+}
+
+// Changes is the difference between two calendar snapshots. Moved holds
+// events whose UID stayed the same but whose dates changed.
+type Changes struct {
+	New       []Event
+	Moved     []EventChange
+	Cancelled []Event
+}
+
+func (c Changes) Empty() bool {
+	return len(c.New) == 0 && len(c.Moved) == 0 && len(c.Cancelled) == 0
+}
+
+func eventKey(ev Event) string {
+	if len(ev.uid) > 0 {
+		return ev.uid
+	}
+	return fmt.Sprintf("%s|%s", ev.summary, ev.startDate.Format(time.RFC3339))
+}
+
+// LastDay is the last day of the event; all-day events end at midnight of
+// the day after.
+func (ev *Event) LastDay() time.Time {
+	return lastDayOfEvent(*ev)
+}
+
+func lastDayOfEvent(ev Event) time.Time {
+	if int(ev.endDate.Sub(ev.startDate).Hours())%24 == 0 {
+		return ev.endDate.Add(-24 * time.Hour)
+	}
+	return ev.endDate
+}
+
+func snapshotEvents(events []Event, since time.Time) map[string]SnapshotEvent {
+	snapshot := map[string]SnapshotEvent{}
+	for _, ev := range events {
+		if !containsString(availableTypes, ev.eventType) || !ev.endDate.After(since) || ev.IsCancelled() {
+			continue
+		}
+		snapshot[eventKey(ev)] = SnapshotEvent{UID: ev.uid, Name: ev.name, EventType: ev.eventType,
+			StartDate: ev.startDate, EndDate: ev.endDate, Emails: ev.Emails()}
+	}
+	return snapshot
+}
+
+// DiffSnapshots compares two snapshots keyed by VEVENT UID. Events that
+// ended before since are ignored so PTO dropping out of the feed once it's
+// over isn't reported as cancelled.
+func DiffSnapshots(previous, current map[string]SnapshotEvent, since time.Time) Changes {
+	var changes Changes
+	for key, cur := range current {
+		prev, ok := previous[key]
+		if !ok {
+			changes.New = append(changes.New, cur.event())
+		} else if !prev.StartDate.Equal(cur.StartDate) || !prev.EndDate.Equal(cur.EndDate) {
+			changes.Moved = append(changes.Moved, EventChange{Previous: prev.event(), Current: cur.event()})
+		}
+	}
+	for key, prev := range previous {
+		if _, ok := current[key]; !ok && prev.EndDate.After(since) {
+			changes.Cancelled = append(changes.Cancelled, prev.event())
+		}
+	}
+
+	sort.Slice(changes.New, func(i, j int) bool {
+		return changes.New[j].startDate.After(changes.New[i].startDate)
+	})
+	sort.Slice(changes.Moved, func(i, j int) bool {
+		return changes.Moved[j].Current.startDate.After(changes.Moved[i].Current.startDate)
+	})
+	sort.Slice(changes.Cancelled, func(i, j int) bool {
+		return changes.Cancelled[j].startDate.After(changes.Cancelled[i].startDate)
+	})
+	return changes
+}
+
+// GetChangesSinceLastRun diffs the calendar against the snapshot saved by the
+// previous run and saves the current one. The first run reports nothing.
+func GetChangesSinceLastRun(store *state.Store) (Changes, error) {
+	start := time.Now().UTC()
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+
+	events, _, err := parseCalendar()
+	if err != nil {
+		return Changes{}, err
+	}
+	current := snapshotEvents(events, start)
+
+	previous := map[string]SnapshotEvent{}
+	hadPrevious := store.Get(ptoSnapshotKey, &previous)
+	store.Set(ptoSnapshotKey, current)
+	if hadPrevious == false {
+		return Changes{}, nil
+	}
+	return DiffSnapshots(previous, current, start), nil
+}
+
+func displayType(eventType string) string {
+	if eventType == workingHome {
+		return workingRemotely
+	}
+	return eventType
+}
+
+// DescribeDates is the day, or first and last day, of an event.
+func DescribeDates(ev Event) string {
+	startDateFormatted := formatDate(ev.startDate)
+	endDateFormatted := formatDate(lastDayOfEvent(ev))
+	if startDateFormatted == endDateFormatted {
+		return startDateFormatted
+	}
+	return fmt.Sprintf("%s ↔︎ %s", startDateFormatted, endDateFormatted)
+}
+
+// DescribeMove says how an event was extended, shortened or moved.
+func DescribeMove(change EventChange) string {
+	prev, cur := change.Previous, change.Current
+	prevLastDay, curLastDay := lastDayOfEvent(prev), lastDayOfEvent(cur)
+	if prev.startDate.Equal(cur.startDate) && curLastDay.After(prevLastDay) {
+		return fmt.Sprintf("%s extended %s to %s", cur.name, displayType(cur.eventType), formatDate(curLastDay))
+	}
+	if prev.startDate.Equal(cur.startDate) && curLastDay.Before(prevLastDay) {
+		return fmt.Sprintf("%s shortened %s to end %s", cur.name, displayType(cur.eventType), formatDate(curLastDay))
+	}
+	return fmt.Sprintf("%s moved %s from %s to %s", cur.name, displayType(cur.eventType), DescribeDates(prev), DescribeDates(cur))
+}
+
+func CreateChangesMessage(changes Changes) (string, error) {
+	messaging := "*Changes since yesterday*:\n\n"
+	for _, ev := range changes.New {
+		messaging = fmt.Sprintf("%s:new: %s booked %s - %s\n", messaging, ev.name, displayType(ev.eventType), DescribeDates(ev))
+	}
+	for _, change := range changes.Moved {
+		messaging = fmt.Sprintf("%s:arrows_counterclockwise: %s\n", messaging, DescribeMove(change))
+	}
+	for _, ev := range changes.Cancelled {
+		messaging = fmt.Sprintf("%s:x: %s cancelled %s - %s\n", messaging, ev.name, displayType(ev.eventType), DescribeDates(ev))
+	}
+	return messaging, nil
+}
@@ -0,0 +1,144 @@
+package justworks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/alert"
+	"github.com/jainmickey/justworks_integration/environment"
+	"github.com/jainmickey/justworks_integration/state"
+)
+
+const calendarFile = "/tmp/justWorksCal.ics"
+const downloadFile = "/tmp/justWorksCal.ics.download"
+const knownGoodFile = "/tmp/justWorksCal.good.ics"
+const lastGoodFeedKey = "justworks_last_good_feed"
+
+var justworksRemediation = "Open https://secure.justworks.com/calendar, click \"Subscribe via iCal\" and set the new url in JustWorksUrl."
+
+func fetchCalendar(url string, filename string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Justworks responded with %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "text/html") {
+		return fmt.Errorf("Justworks responded with %s instead of a calendar, the link has probably expired", contentType)
+	}
+
+	out, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error in creating calender file")
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, resp.Body)
+	if err != nil {
+		fmt.Println("Error in saving calender file")
+		return err
+	}
+	return out.Sync()
+}
+
+func validateCalendarFile(filename string) error {
+	file, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	content := bytes.TrimSpace(bytes.TrimPrefix(file, []byte("\xef\xbb\xbf")))
+	if !bytes.HasPrefix(content, []byte("BEGIN:VCALENDAR")) {
+		return errors.New("Downloaded file is not a calendar (no BEGIN:VCALENDAR)")
+	}
+	if !bytes.HasSuffix(content, []byte("END:VCALENDAR")) {
+		return errors.New("Downloaded calendar is truncated (no END:VCALENDAR)")
+	}
+	return nil
+}
+
+func copyFile(from string, to string) error {
+	content, err := ioutil.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(to, content, 0644)
+}
+
+// restoreKnownGood puts the last calendar that passed validation back in
+// place and returns when it was downloaded.
+func restoreKnownGood(store *state.Store) (time.Time, error) {
+	var lastGood time.Time
+	if store.Get(lastGoodFeedKey, &lastGood) == false {
+		return lastGood, errors.New("No known-good calendar saved yet")
+	}
+	err := store.RestoreFile(knownGoodFile)
+	if err == nil {
+		err = validateCalendarFile(knownGoodFile)
+	}
+	if err == nil {
+		err = copyFile(knownGoodFile, calendarFile)
+	}
+	return lastGood, err
+}
+
+// DownloadJustWorksFile fetches the feed into a temp file and only replaces
+// the calendar once it's known to be valid. When the fresh feed is bad the
+// last known-good copy is used instead and an alert is raised; the bool is
+// false only when there's no usable calendar at all.
+func DownloadJustWorksFile(config *environment.Config, store *state.Store, alerter alert.Alerter) (bool, error) {
+	os.Remove(downloadFile)
+	err := fetchCalendar(config.JustWorks.URL.Value(), downloadFile)
+	if err == nil {
+		err = validateCalendarFile(downloadFile)
+	}
+	if err == nil {
+		err = os.Rename(downloadFile, calendarFile)
+	}
+	if err == nil {
+		fmt.Println("Justworks File Saved")
+		if copyErr := copyFile(calendarFile, knownGoodFile); copyErr == nil {
+			if saveErr := store.SaveFile(knownGoodFile); saveErr == nil {
+				store.Set(lastGoodFeedKey, time.Now())
+			} else {
+				fmt.Println("Error in saving known-good calendar: ", saveErr)
+			}
+		}
+		return true, nil
+	}
+
+	fmt.Println("Error in fetching calender: ", err)
+	os.Remove(downloadFile)
+	lastGood, restoreErr := restoreKnownGood(store)
+	if restoreErr != nil {
+		alerter.Send(alert.Alert{
+			Key:         "justworks-download",
+			Severity:    alert.Critical,
+			Subject:     "Error in Justworks Integration",
+			Message:     fmt.Sprintf("Justworks link expired: %s\n\nNo known-good copy to fall back to (%s), nothing was posted.", err, restoreErr),
+			Remediation: justworksRemediation,
+		})
+		return false, err
+	}
+
+	alerter.Send(alert.Alert{
+		Key:      "justworks-download",
+		Severity: alert.Warning,
+		Subject:  "Error in Justworks Integration",
+		Message: fmt.Sprintf("Justworks link expired: %s\n\nUsing the last known-good calendar from %s, new time off won't show up until this is fixed.",
+			err, lastGood.Format(time.RFC1123)),
+		Remediation: justworksRemediation,
+	})
+	return true, fmt.Errorf("Using calendar from %s: %s", lastGood.Format(time.RFC3339), err)
+}
@@ -0,0 +1,129 @@
+package justworks
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/alert"
+	"github.com/jainmickey/justworks_integration/environment"
+	"github.com/jainmickey/justworks_integration/state"
+)
+
+const feedSnapshotKey = "justworks_feed_snapshot"
+
+// FeedSnapshot is what's remembered about a parse of the feed so the next
+// run can tell if Justworks changed it under us.
+type FeedSnapshot struct {
+	TakenAt    time.Time      `json:"taken_at"`
+	EventCount int            `json:"event_count"`
+	TypeCounts map[string]int `json:"type_counts"`
+}
+
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func percentOf(part int, total int) int {
+	if total == 0 {
+		return 0
+	}
+	return part * 100 / total
+}
+
+func takeSnapshot(events []Event) FeedSnapshot {
+	snapshot := FeedSnapshot{TakenAt: time.Now(), EventCount: len(events), TypeCounts: map[string]int{}}
+	for _, ev := range events {
+		if len(ev.eventType) > 0 {
+			snapshot.TypeCounts[ev.eventType]++
+		}
+	}
+	return snapshot
+}
+
+func checkFeedHealth(current FeedSnapshot, previous *FeedSnapshot, stats parseStats, config environment.FeedHealthConfig) []string {
+	var problems []string
+
+	if previous != nil && previous.EventCount >= config.MinEventsToCompare {
+		dropped := previous.EventCount - current.EventCount
+		if percentOf(dropped, previous.EventCount) > config.MaxEventDropPercent {
+			problems = append(problems, fmt.Sprintf("Event count dropped from %d to %d since %s.",
+				previous.EventCount, current.EventCount, previous.TakenAt.Format("Mon, 2 Jan")))
+		}
+	}
+
+	var unknownTypes []string
+	for eventType := range current.TypeCounts {
+		if containsString(availableTypes, eventType) {
+			continue
+		}
+		if previous != nil {
+			if _, ok := previous.TypeCounts[eventType]; ok {
+				continue
+			}
+		}
+		unknownTypes = append(unknownTypes, eventType)
+	}
+	if len(unknownTypes) > 0 {
+		sort.Strings(unknownTypes)
+		problems = append(problems, fmt.Sprintf("New leave types in the feed: %s.", strings.Join(unknownTypes, ", ")))
+	}
+
+	if previous != nil {
+		for _, eventType := range availableTypes {
+			if previous.TypeCounts[eventType] > 0 && current.TypeCounts[eventType] == 0 {
+				problems = append(problems, fmt.Sprintf("No \"%s\" events any more (%d last time), was it renamed?",
+					eventType, previous.TypeCounts[eventType]))
+			}
+		}
+	}
+
+	if percentOf(stats.UnparseableTypes, stats.Entries) > config.MaxUnparseablePercent {
+		problems = append(problems, fmt.Sprintf("%d of %d summaries have no \"(Leave Type)\" in them.",
+			stats.UnparseableTypes, stats.Entries))
+	}
+	skipped := stats.MissingSummary + stats.BadStartDate + stats.BadEndDate
+	if percentOf(skipped, stats.Entries) > config.MaxUnparseablePercent {
+		problems = append(problems, fmt.Sprintf("%d of %d events were skipped (%d without summary, %d with a bad dtstart, %d with a bad dtend).",
+			skipped, stats.Entries, stats.MissingSummary, stats.BadStartDate, stats.BadEndDate))
+	}
+	return problems
+}
+
+// CheckFeedHealth compares the calendar with the snapshot from the previous
+// run and alerts the admins when it looks like the feed format changed.
+func CheckFeedHealth(config *environment.Config, store *state.Store, alerter alert.Alerter) ([]string, error) {
+	events, stats, err := parseCalendar()
+	if err != nil {
+		return nil, err
+	}
+
+	current := takeSnapshot(events)
+	var previous *FeedSnapshot
+	var lastSnapshot FeedSnapshot
+	if store.Get(feedSnapshotKey, &lastSnapshot) {
+		previous = &lastSnapshot
+	}
+
+	problems := checkFeedHealth(current, previous, stats, config.FeedHealth)
+	fmt.Println("Feed health", current.EventCount, stats, problems)
+	if len(problems) > 0 {
+		alerter.Send(alert.Alert{
+			Key:      "justworks-feed-health",
+			Severity: alert.Warning,
+			Subject:  "Justworks calendar looks different",
+			Message: fmt.Sprintf("The Justworks feed changed in a way that may break the digests:\n\n- %s",
+				strings.Join(problems, "\n- ")),
+			Remediation: "Compare the feed with the leave types in the justworks package and update them if Justworks renamed anything.",
+		})
+	}
+
+	store.Set(feedSnapshotKey, current)
+	return problems, nil
+}
@@ -0,0 +1,18 @@
+package justworks
+
+import (
+	"fmt"
+
+	"github.com/jainmickey/justworks_integration/holidays"
+)
+
+func CreateHolidaysMessage(holidaysList []holidays.Holiday) (string, error) {
+	if len(holidaysList) == 0 {
+		return "", nil
+	}
+	messaging := "\n:calendar: *Upcoming holidays*:\n\n"
+	for _, holiday := range holidaysList {
+		messaging = fmt.Sprintf("%s- %s (%s office) - %s\n", messaging, holiday.Name, holiday.Office, formatDate(holiday.Date))
+	}
+	return messaging, nil
+}
@@ -3,30 +3,44 @@ package justworks
 import (
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
 	"regexp"
 	"sort"
 	"strings"
 	"time"
 
-	"github.com/jainmickey/justworks_integration/ses"
+	"github.com/jainmickey/justworks_integration/environment"
+	"github.com/jainmickey/justworks_integration/workcal"
 	"github.com/lestrrat-go/ical"
 )
 
-var vacation = "Vacation"
-var workingRemotely = "Working Remotely"
-var workingHome = "Working from Home (Same Timezone"
-var casualLeave = "Casual Leave - Noida Team Only"
-var sickLeave = "Sick Leave"
-var availableTypes = []string{vacation, workingRemotely, casualLeave, sickLeave, workingHome}
-var vacationTypes = []string{vacation, casualLeave, sickLeave}
-var productAccountsVacationTypes = []string{vacation}
+// The Justworks leave types. Vacation and CasualLeave are always booked in
+// Forecast too.
+const (
+	Vacation        = "Vacation"
+	workingRemotely = "Working Remotely"
+	workingHome     = "Working from Home (Same Timezone"
+	CasualLeave     = "Casual Leave - Noida Team Only"
+	sickLeave       = "Sick Leave"
+)
+
+var availableTypes = []string{Vacation, workingRemotely, CasualLeave, sickLeave, workingHome}
+var vacationTypes = []string{Vacation, CasualLeave, sickLeave}
+var productAccountsVacationTypes = []string{Vacation}
 
 type Event struct {
-	summary, eventType, name string
-	startDate, endDate       time.Time
+	uid, summary, eventType, name string
+	startDate, endDate            time.Time
+	description, status           string
+	organizer                     string
+	attendees                     []string
+	lastModified                  time.Time
+	sequence                      int
+	dayPart                       DayPart
+	xProperties                   map[string]string
+}
+
+func (ev *Event) UID() string {
+	return ev.uid
 }
 
 func (ev *Event) StartDate() time.Time {
@@ -72,7 +86,6 @@ func formatDate(t time.Time) string {
 }
 
 func getNameFromEventSummary(eventSummary string, eventType string) (string, error) {
-	fmt.Println("Event Name", eventSummary)
 	reLeadcloseWhtsp := regexp.MustCompile(`^[\s\p{Zs}]+|[\s\p{Zs}]+$`)
 	reInsideWhtsp := regexp.MustCompile(`[\s\p{Zs}]{2,}`)
 	eventTypeString := fmt.Sprintf("(%s)", eventType)
@@ -81,13 +94,12 @@ func getNameFromEventSummary(eventSummary string, eventType string) (string, err
 	strippedMessage = reLeadcloseWhtsp.ReplaceAllString(strippedMessage, "")
 	strippedMessage = reInsideWhtsp.ReplaceAllString(strippedMessage, "")
 	strippedMessage = strings.Replace(strippedMessage, ")", "", -1)
-	fmt.Println("Stripped Event Name", strippedMessage)
 	return strippedMessage, nil
 }
 
 func getEventEmoji(eventType string) (string, error) {
-	emojiesMapping := map[string]string{vacation: ":beach_with_umbrella:", workingRemotely: ":house_with_garden:",
-		casualLeave: ":beach_with_umbrella:", sickLeave: ":face_with_thermometer:", workingHome: ":house_with_garden:"}
+	emojiesMapping := map[string]string{Vacation: ":beach_with_umbrella:", workingRemotely: ":house_with_garden:",
+		CasualLeave: ":beach_with_umbrella:", sickLeave: ":face_with_thermometer:", workingHome: ":house_with_garden:"}
 	if val, ok := emojiesMapping[eventType]; ok {
 		return val, nil
 	}
@@ -95,6 +107,13 @@ func getEventEmoji(eventType string) (string, error) {
 	return "", errors.New(errorMessage)
 }
 
+// Emoji is the emoji the digests use for the leave type, empty if there
+// isn't one.
+func (ev *Event) Emoji() string {
+	emoji, _ := getEventEmoji(ev.eventType)
+	return emoji
+}
+
 func createPTOText(event Event, upcoming bool) (string, error) {
 	startDateFormatted := formatDate(event.startDate)
 	endDateFormatted := formatDate(event.endDate)
@@ -107,6 +126,9 @@ func createPTOText(event Event, upcoming bool) (string, error) {
 	if int(duration) < 25 {
 		dateMessage = fmt.Sprintf("%s", startDateFormatted)
 	}
+	if event.IsPartialDay() {
+		dateMessage = partialDayText(event)
+	}
 
 	message := fmt.Sprintf("- %s - %s\n", event.name, dateMessage)
 	if upcoming == true {
@@ -122,7 +144,7 @@ func createPTOText(event Event, upcoming bool) (string, error) {
 	return message, nil
 }
 
-func CreateEventMessage(sortedEventsList map[string][]Event) (string, error) {
+func CreateEventMessage(sortedEventsList map[string][]Event, calendar workcal.Calendar) (string, error) {
 	messaging := "Hey there :wave:, keeping you up to date on who's O.O.O. this week"
 	for key, val := range sortedEventsList {
 		fmt.Println("Emoji", key)
@@ -135,6 +157,9 @@ func CreateEventMessage(sortedEventsList map[string][]Event) (string, error) {
 					fmt.Println("Event", ev.summary, ev.startDate, ev.endDate)
 					// Bool specify its upcoming event or not
 					ptoText, _ := createPTOText(ev, false)
+					if key != workingRemotely {
+						ptoText = fmt.Sprintf("%s, %s\n", strings.TrimSuffix(ptoText, "\n"), calendar.ReturnPhrase(ev.LastDay(), time.Now()))
+					}
 					message = fmt.Sprintf("%s%s", message, ptoText)
 				}
 			}
@@ -144,11 +169,17 @@ func CreateEventMessage(sortedEventsList map[string][]Event) (string, error) {
 	return messaging, nil
 }
 
-func CreateProductAndAccountMessage(sortedEventsList map[string][]Event, upcoming bool) (string, error) {
-	messaging := "Hey there :wave:, keeping you up to date on who's *OOO* in *Product and Accounts* team today:"
+func CreateProductAndAccountMessage(sortedEventsList map[string][]Event, upcoming bool, calendarFor CalendarFor) (string, error) {
+	return CreateTeamMessage("Product and Accounts", "all Fueled employees", sortedEventsList, upcoming, calendarFor)
+}
+
+// CreateTeamMessage is the daily digest of one team, upcomingFor says who the
+// upcoming section covers.
+func CreateTeamMessage(team string, upcomingFor string, sortedEventsList map[string][]Event, upcoming bool, calendarFor CalendarFor) (string, error) {
+	messaging := fmt.Sprintf("Hey there :wave:, keeping you up to date on who's *OOO* in *%s* team today:", team)
 	upcomigEvents := true
 	if upcoming == true {
-		messaging = "\n*Upcoming OOOs (all Fueled employees)*:\n\n"
+		messaging = fmt.Sprintf("\n*Upcoming OOOs (%s)*:\n\n", upcomingFor)
 		upcomigEvents = false
 	}
 	for key, val := range sortedEventsList {
@@ -164,6 +195,7 @@ func CreateProductAndAccountMessage(sortedEventsList map[string][]Event, upcomin
 			for _, ev := range val {
 				fmt.Println("Event", ev.summary, ev.startDate, ev.endDate)
 				ptoText, _ := createPTOText(ev, upcoming)
+				ptoText = appendReturnText(ptoText, ev, calendarFor)
 				message = fmt.Sprintf("%s%s", message, ptoText)
 				upcomigEvents = true
 			}
@@ -195,11 +227,11 @@ func setTypeNameOfEvent(events []Event) ([]Event, error) {
 
 func SortCalenderItems(events []Event, forProductAccountPeople, upcoming bool) (map[string][]Event, error) {
 	sortedEvents := map[string][]Event{
-		vacation:        []Event{},
+		Vacation:        []Event{},
 		workingRemotely: []Event{},
 	}
 	if forProductAccountPeople == false {
-		sortedEvents[casualLeave] = []Event{}
+		sortedEvents[CasualLeave] = []Event{}
 		sortedEvents[sickLeave] = []Event{}
 	}
 	for _, ev := range events {
@@ -212,7 +244,7 @@ func SortCalenderItems(events []Event, forProductAccountPeople, upcoming bool) (
 				if val, ok := sortedEvents[eventType]; ok {
 					if upcoming == true {
 						// ---- For upcoming events merge all in one group to be sorted together ----------
-						sortedEvents[vacation] = append(sortedEvents[vacation], ev)
+						sortedEvents[Vacation] = append(sortedEvents[Vacation], ev)
 					} else {
 						sortedEvents[eventType] = append(val, ev)
 					}
@@ -230,51 +262,25 @@ func SortCalenderItems(events []Event, forProductAccountPeople, upcoming bool) (
 	return sortedEvents, nil
 }
 
-func DownloadJustWorksFile(envVars map[string]string) (bool, error) {
-	_, err := os.Stat("/tmp/justWorksCal.ics")
-	if err == nil {
-		os.Remove("/tmp/justWorksCal.ics")
-	}
-	out, err := os.Create("/tmp/justWorksCal.ics")
-	if err != nil {
-		fmt.Println("Error in creating calender file")
-		return false, err
-	}
-	defer out.Close()
-
-	fmt.Println("Justworks File Created!")
-
-	resp, err := http.Get(envVars["JustWorksUrl"])
-	if err != nil {
-		fmt.Println("Error in fetching calender")
-		emailSubject := "Error in Justworks Integration"
-		emailBody := fmt.Sprintf("Justworks link expired: %s", err)
-		ses.SendEmailSMTP(envVars["DefaultFromEmail"], envVars["AdminEmail"], emailSubject, emailBody, envVars)
-		return false, err
-	}
-	defer resp.Body.Close()
-
-	fmt.Println("Justworks File Fetched")
-
-	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		fmt.Println("Error in saving calender file")
-		return false, err
-	}
-
-	fmt.Println("Justworks File Saved")
-	return true, nil
+// parseStats counts what parseCalendar had to drop, so a feed that silently
+// changed shape can be noticed.
+type parseStats struct {
+	Entries          int
+	MissingSummary   int
+	BadStartDate     int
+	BadEndDate       int
+	UnparseableTypes int
 }
 
-func GetByDateRange(fromDate time.Time, toDate time.Time, envVars map[string]string) ([]Event, error) {
+func parseCalendar() ([]Event, parseStats, error) {
 	var eventsList []Event
+	var stats parseStats
 
 	p := ical.NewParser()
-	c, err := p.ParseFile("/tmp/justWorksCal.ics")
+	c, err := p.ParseFile(calendarFile)
 	if err != nil {
 		fmt.Println("Error", err)
-		return eventsList, err
+		return eventsList, stats, err
 	}
 
 	for e := range c.Entries() {
@@ -282,202 +288,139 @@ func GetByDateRange(fromDate time.Time, toDate time.Time, envVars map[string]str
 		if !ok {
 			continue
 		}
+		stats.Entries++
 
-		layout := "20060102T000000"
 		prop, ok := ev.GetProperty("summary")
 		if !ok {
+			stats.MissingSummary++
 			continue
 		}
 		prop2, ok := ev.GetProperty("dtstart")
 		if !ok {
+			stats.BadStartDate++
 			continue
 		}
-		prop2Time, err := time.Parse(layout, prop2.RawValue())
+		prop2Time, err := parseEventTime(prop2.RawValue())
 		if err != nil {
 			fmt.Println("Error", err)
+			stats.BadStartDate++
 			continue
 		}
 		prop3, ok := ev.GetProperty("dtend")
 		if !ok {
+			stats.BadEndDate++
 			continue
 		}
-		prop3Time, err := time.Parse(layout, prop3.RawValue())
+		prop3Time, err := parseEventTime(prop3.RawValue())
 		if err != nil {
+			stats.BadEndDate++
 			continue
 		}
 
-		if prop2Time.After(fromDate) && prop2Time.Before(toDate) {
-			event := Event{summary: prop.RawValue(), startDate: prop2Time, endDate: prop3Time}
-			eventsList = append(eventsList, event)
-		}
+		event := Event{summary: prop.RawValue(), startDate: prop2Time, endDate: prop3Time}
+		setMetadataOfEvent(&event, ev)
+		eventsList = append(eventsList, event)
 	}
 
 	eventsList, _ = setTypeNameOfEvent(eventsList)
-	return eventsList, nil
+	for index, ev := range eventsList {
+		setDayPartOfEvent(&eventsList[index])
+		if len(ev.eventType) == 0 {
+			stats.UnparseableTypes++
+		}
+	}
+	return eventsList, stats, nil
 }
 
-func GetByStartDate(fromDate time.Time, envVars map[string]string) ([]Event, error) {
+func filterEvents(keep func(ev Event) bool) ([]Event, error) {
 	var eventsList []Event
-
-	p := ical.NewParser()
-	c, err := p.ParseFile("/tmp/justWorksCal.ics")
+	allEvents, _, err := parseCalendar()
 	if err != nil {
-		fmt.Println("Error", err)
 		return eventsList, err
 	}
-
-	for e := range c.Entries() {
-		ev, ok := e.(*ical.Event)
-		if !ok {
-			continue
+	for _, ev := range allEvents {
+		if keep(ev) {
+			eventsList = append(eventsList, ev)
 		}
+	}
+	return eventsList, nil
+}
 
-		layout := "20060102T000000"
-		prop, ok := ev.GetProperty("summary")
-		if !ok {
-			continue
-		}
-		prop2, ok := ev.GetProperty("dtstart")
-		if !ok {
-			continue
-		}
-		prop2Time, err := time.Parse(layout, prop2.RawValue())
-		if err != nil {
-			fmt.Println("Error", err)
-			continue
-		}
-		prop3, ok := ev.GetProperty("dtend")
-		if !ok {
-			continue
-		}
-		prop3Time, err := time.Parse(layout, prop3.RawValue())
-		if err != nil {
-			continue
-		}
+func GetByDateRange(fromDate time.Time, toDate time.Time, config *environment.Config) ([]Event, error) {
+	return filterEvents(func(ev Event) bool {
+		return ev.startDate.After(fromDate) && ev.startDate.Before(toDate)
+	})
+}
 
-		if prop2Time.After(fromDate) {
-			event := Event{summary: prop.RawValue(), startDate: prop2Time, endDate: prop3Time}
-			eventsList = append(eventsList, event)
-		}
+// GetOverlapping returns every event that is on at some point between
+// fromDate and toDate, including those that started earlier.
+func GetOverlapping(fromDate time.Time, toDate time.Time, config *environment.Config) ([]Event, error) {
+	return filterEvents(func(ev Event) bool {
+		return ev.startDate.Before(toDate) && ev.endDate.After(fromDate)
+	})
+}
+
+// IsAbsence is false for remote work, which doesn't count as time off, and
+// for partial days unless partialDays is set.
+func (ev *Event) IsAbsence(partialDays bool) bool {
+	if !partialDays && ev.IsPartialDay() {
+		return false
 	}
+	return len(ev.eventType) > 0 && ev.eventType != workingRemotely && ev.eventType != workingHome
+}
 
-	eventsList, _ = setTypeNameOfEvent(eventsList)
-	return eventsList, nil
+// DisplayType is the leave type as shown in digests.
+func (ev *Event) DisplayType() string {
+	return displayType(ev.eventType)
 }
 
-func GetTodaysEvents(envVars map[string]string) ([]Event, error) {
-	var eventsList []Event
+func GetByStartDate(fromDate time.Time, config *environment.Config) ([]Event, error) {
+	return filterEvents(func(ev Event) bool {
+		return ev.startDate.After(fromDate)
+	})
+}
+
+func GetTodaysEvents(config *environment.Config) ([]Event, error) {
 	start := time.Now().UTC()
 	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
 	startAMinuteBefore := start.Add(-1 * time.Minute)
 	end := start.Add(24 * time.Hour)
 	endAMinuteBefore := end.Add(-1 * time.Minute)
 
-	p := ical.NewParser()
-	c, err := p.ParseFile("/tmp/justWorksCal.ics")
-	if err != nil {
-		fmt.Println("Error", err)
-		return eventsList, err
-	}
-
-	for e := range c.Entries() {
-		ev, ok := e.(*ical.Event)
-		if !ok {
-			continue
-		}
-
-		layout := "20060102T000000"
-		prop, ok := ev.GetProperty("summary")
-		if !ok {
-			continue
-		}
-		prop2, ok := ev.GetProperty("dtstart")
-		if !ok {
-			continue
-		}
-		prop2Time, err := time.Parse(layout, prop2.RawValue())
-		if err != nil {
-			fmt.Println("Error", err)
-			continue
-		}
-		prop3, ok := ev.GetProperty("dtend")
-		if !ok {
-			continue
-		}
-		prop3Time, err := time.Parse(layout, prop3.RawValue())
-		if err != nil {
-			continue
-		}
-
-		if (prop2Time.After(startAMinuteBefore) && prop2Time.Before(end)) || (prop2Time.Before(startAMinuteBefore) && prop3Time.After(endAMinuteBefore)) ||
-			(prop3Time.After(start) && prop3Time.Before(end)) {
-			event := Event{summary: prop.RawValue(), startDate: prop2Time, endDate: prop3Time}
-			eventsList = append(eventsList, event)
-		}
-	}
-
-	eventsList, _ = setTypeNameOfEvent(eventsList)
-	return eventsList, nil
+	return filterEvents(func(ev Event) bool {
+		return (ev.startDate.After(startAMinuteBefore) && ev.startDate.Before(end)) ||
+			(ev.startDate.Before(startAMinuteBefore) && ev.endDate.After(endAMinuteBefore)) ||
+			(ev.endDate.After(start) && ev.endDate.Before(end))
+	})
 }
 
-func GetUpcomingEvents(envVars map[string]string) ([]Event, error) {
-	var eventsList []Event
+// UpcomingDateRange is tomorrow until the end of next week, the window the
+// upcoming section of the daily digest covers.
+func UpcomingDateRange() (time.Time, time.Time) {
 	start := time.Now().UTC()
 	start = start.Add(24 * time.Hour)
 	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
-	startAMinuteBefore := start.Add(-1 * time.Minute)
 	daysForUpcoming := time.Duration(7 + (6 - int(start.Weekday())))
 	end := start.Add(daysForUpcoming * 24 * time.Hour)
+	return start, end
+}
 
-	p := ical.NewParser()
-	c, err := p.ParseFile("/tmp/justWorksCal.ics")
-	if err != nil {
-		fmt.Println("Error", err)
-		return eventsList, err
-	}
-
-	for e := range c.Entries() {
-		ev, ok := e.(*ical.Event)
-		if !ok {
-			continue
-		}
-
-		layout := "20060102T000000"
-		prop, ok := ev.GetProperty("summary")
-		if !ok {
-			continue
-		}
-		prop2, ok := ev.GetProperty("dtstart")
-		if !ok {
-			continue
-		}
-		prop2Time, err := time.Parse(layout, prop2.RawValue())
-		if err != nil {
-			fmt.Println("Error", err)
-			continue
-		}
-		prop3, ok := ev.GetProperty("dtend")
-		if !ok {
-			continue
-		}
-		prop3Time, err := time.Parse(layout, prop3.RawValue())
-		if err != nil {
-			continue
-		}
-
-		if prop2Time.After(startAMinuteBefore) && prop2Time.Before(end) {
-			event := Event{summary: prop.RawValue(), startDate: prop2Time, endDate: prop3Time}
-			eventsList = append(eventsList, event)
-		}
-	}
+func GetUpcomingEvents(config *environment.Config) ([]Event, error) {
+	start, end := UpcomingDateRange()
+	startAMinuteBefore := start.Add(-1 * time.Minute)
 
-	eventsList, _ = setTypeNameOfEvent(eventsList)
-	return eventsList, nil
+	return filterEvents(func(ev Event) bool {
+		return ev.startDate.After(startAMinuteBefore) && ev.startDate.Before(end)
+	})
 }
 
 func FilterEventsForVacation(events []Event) ([]Event, error) {
 	var filteredEventsList []Event
 	for _, ev := range events {
+		// ------- Cancelled and not yet approved PTO isn't announced -----------
+		if ev.IsCancelled() || ev.IsTentative() {
+			continue
+		}
 		if len(ev.eventType) > 0 {
 			if sort.SearchStrings(vacationTypes, ev.eventType) <= len(vacationTypes) {
 				filteredEventsList = append(filteredEventsList, ev)
@@ -490,6 +433,9 @@ func FilterEventsForVacation(events []Event) ([]Event, error) {
 func FilterEventsForVacationAndRemote(events []Event) ([]Event, error) {
 	var filteredEventsList []Event
 	for _, ev := range events {
+		if ev.IsCancelled() || ev.IsTentative() {
+			continue
+		}
 		if len(ev.eventType) > 0 {
 			if sort.SearchStrings(availableTypes, ev.eventType) <= len(availableTypes) {
 				filteredEventsList = append(filteredEventsList, ev)
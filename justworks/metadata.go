@@ -0,0 +1,119 @@
+package justworks
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/ical"
+)
+
+const statusCancelled = "CANCELLED"
+const statusTentative = "TENTATIVE"
+
+func (ev *Event) Description() string {
+	return ev.description
+}
+
+// Status is the VEVENT STATUS, CONFIRMED when the feed doesn't say.
+func (ev *Event) Status() string {
+	if len(ev.status) == 0 {
+		return "CONFIRMED"
+	}
+	return ev.status
+}
+
+func (ev *Event) IsCancelled() bool {
+	return ev.status == statusCancelled
+}
+
+func (ev *Event) IsTentative() bool {
+	return ev.status == statusTentative
+}
+
+func (ev *Event) LastModified() time.Time {
+	return ev.lastModified
+}
+
+func (ev *Event) Sequence() int {
+	return ev.sequence
+}
+
+func (ev *Event) Organizer() string {
+	return ev.organizer
+}
+
+func (ev *Event) Attendees() []string {
+	return ev.attendees
+}
+
+// Emails returns the attendee addresses, lower-cased, which is what people
+// are matched on in Forecast and Slack. The organizer is left out, it can
+// be the calendar owner or HR rather than the person who's away.
+func (ev *Event) Emails() []string {
+	var emails []string
+	for _, attendee := range ev.attendees {
+		if !containsString(emails, attendee) {
+			emails = append(emails, attendee)
+		}
+	}
+	return emails
+}
+
+func (ev *Event) HasEmail(email string) bool {
+	return len(email) > 0 && containsString(ev.Emails(), strings.ToLower(email))
+}
+
+// XProperty returns a vendor specific property, e.g. "X-JUSTWORKS-TYPE".
+func (ev *Event) XProperty(name string) (string, bool) {
+	val, ok := ev.xProperties[strings.ToUpper(name)]
+	return val, ok
+}
+
+func (ev *Event) XProperties() map[string]string {
+	return ev.xProperties
+}
+
+func parseEmail(value string) string {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(strings.ToLower(value), "mailto:") {
+		value = value[len("mailto:"):]
+	}
+	return strings.ToLower(value)
+}
+
+func parseICalTime(value string) (time.Time, error) {
+	t, err := time.Parse("20060102T150405Z", value)
+	if err != nil {
+		t, err = time.Parse("20060102T150405", value)
+	}
+	return t, err
+}
+
+func setMetadataOfEvent(event *Event, ev *ical.Event) {
+	for prop := range ev.Properties() {
+		name := strings.ToUpper(prop.Name())
+		value := prop.RawValue()
+		switch {
+		case name == "UID":
+			event.uid = value
+		case name == "DESCRIPTION":
+			event.description = strings.Replace(value, "\\n", "\n", -1)
+		case name == "STATUS":
+			event.status = strings.ToUpper(value)
+		case name == "SEQUENCE":
+			event.sequence, _ = strconv.Atoi(value)
+		case name == "LAST-MODIFIED":
+			event.lastModified, _ = parseICalTime(value)
+		case name == "ORGANIZER":
+			event.organizer = parseEmail(value)
+		case name == "ATTENDEE":
+			event.attendees = append(event.attendees, parseEmail(value))
+		case strings.HasPrefix(name, "X-"):
+			if event.xProperties == nil {
+				event.xProperties = map[string]string{}
+			}
+			event.xProperties[name] = value
+		}
+	}
+}
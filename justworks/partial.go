@@ -0,0 +1,145 @@
+package justworks
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/workcal"
+)
+
+// DayPart says how much of each day an event takes. Justworks sends
+// partial days either as timed events or as all-day events with "Half Day",
+// "(AM)" or "(PM)" in the summary.
+type DayPart int
+
+const (
+	FullDay DayPart = iota
+	Morning
+	Afternoon
+	HalfDay
+	Hours
+)
+
+// WorkingHoursPerDay is a full day off in hours.
+const WorkingHoursPerDay = 8
+
+var reHalfDay = regexp.MustCompile(`(?i)\bhalf[- ]?day\b`)
+var reMorning = regexp.MustCompile(`(?i)\(\s*AM\s*\)`)
+var reAfternoon = regexp.MustCompile(`(?i)\(\s*PM\s*\)`)
+
+func parseEventTime(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405", "20060102T150405Z", "20060102"} {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Parse("20060102T150405", value)
+}
+
+func (ev *Event) DayPart() DayPart {
+	return ev.dayPart
+}
+
+func (ev *Event) IsPartialDay() bool {
+	return ev.dayPart != FullDay
+}
+
+// HoursPerDay is how many working hours a day the event takes off.
+func (ev *Event) HoursPerDay() float64 {
+	switch ev.dayPart {
+	case Morning, Afternoon, HalfDay:
+		return WorkingHoursPerDay / 2
+	case Hours:
+		return ev.endDate.Sub(ev.startDate).Hours()
+	}
+	return WorkingHoursPerDay
+}
+
+// OutOn is how much of date the events take off, 1 for a full day. Remote
+// work, cancelled and tentative events don't count.
+func OutOn(events []Event, date time.Time) float64 {
+	out := 0.0
+	for _, ev := range events {
+		if !ev.IsAbsence(true) || ev.IsCancelled() || ev.IsTentative() {
+			continue
+		}
+		if date.Before(workcal.Day(ev.StartDate())) || date.After(ev.LastDay()) {
+			continue
+		}
+		out += ev.HoursPerDay() / WorkingHoursPerDay
+	}
+	if out > 1 {
+		return 1
+	}
+	return out
+}
+
+func isMidnight(t time.Time) bool {
+	return t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0
+}
+
+func setDayPartOfEvent(ev *Event) {
+	summary := ev.summary
+	switch {
+	case reMorning.MatchString(summary):
+		ev.dayPart = Morning
+	case reAfternoon.MatchString(summary):
+		ev.dayPart = Afternoon
+	case reHalfDay.MatchString(summary):
+		ev.dayPart = HalfDay
+	case !isMidnight(ev.startDate) || !isMidnight(ev.endDate):
+		duration := ev.endDate.Sub(ev.startDate)
+		if duration <= 0 || duration >= 24*time.Hour {
+			break
+		}
+		ev.dayPart = Hours
+		if duration.Hours() == WorkingHoursPerDay/2 && ev.endDate.Day() == ev.startDate.Day() {
+			if ev.endDate.Hour() <= 13 {
+				ev.dayPart = Morning
+			} else if ev.startDate.Hour() >= 12 {
+				ev.dayPart = Afternoon
+			}
+		}
+	}
+
+	if ev.dayPart != FullDay && len(ev.eventType) > 0 {
+		summary = reMorning.ReplaceAllString(summary, "")
+		summary = reAfternoon.ReplaceAllString(summary, "")
+		summary = reHalfDay.ReplaceAllString(summary, "")
+		ev.name, _ = getNameFromEventSummary(summary, ev.eventType)
+	}
+}
+
+func formatClock(t time.Time, withSuffix bool) string {
+	layout := "3"
+	if t.Minute() != 0 {
+		layout = "3:04"
+	}
+	if withSuffix {
+		layout = layout + "pm"
+	}
+	return t.Format(layout)
+}
+
+// formatTimeRange renders "2–5pm" or "11am–2pm".
+func formatTimeRange(start, end time.Time) string {
+	sameHalf := (start.Hour() < 12) == (end.Hour() < 12)
+	return fmt.Sprintf("%s–%s", formatClock(start, !sameHalf), formatClock(end, true))
+}
+
+func partialDayText(ev Event) string {
+	day := formatDate(ev.startDate)
+	switch ev.dayPart {
+	case Morning:
+		return fmt.Sprintf("%s (AM)", day)
+	case Afternoon:
+		return fmt.Sprintf("%s (PM)", day)
+	case HalfDay:
+		return fmt.Sprintf("%s (half day)", day)
+	case Hours:
+		return fmt.Sprintf("%s %s", day, formatTimeRange(ev.startDate, ev.endDate))
+	}
+	return day
+}
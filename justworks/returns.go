@@ -0,0 +1,44 @@
+package justworks
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/workcal"
+)
+
+// CalendarFor finds the working calendar of the person an event belongs to,
+// so return dates follow their working days and office holidays.
+type CalendarFor func(ev Event) workcal.Calendar
+
+// returnText says when someone is back in the office, e.g. "out today, back
+// Monday", "out until Oct 24" or "last day before leave" for PTO that starts
+// on the next working day.
+func returnText(ev Event, calendar workcal.Calendar, now time.Time) string {
+	today := workcal.Day(now)
+	firstDay := workcal.Day(ev.startDate)
+	lastDay := workcal.Day(ev.LastDay())
+	back := calendar.ReturnPhrase(lastDay, today)
+
+	if firstDay.After(today) {
+		if calendar.PreviousWorkingDay(firstDay).Equal(today) {
+			return fmt.Sprintf("today is the last day before leave, %s", back)
+		}
+		return back
+	}
+	if lastDay.Equal(today) {
+		return fmt.Sprintf("out today, %s", back)
+	}
+	if lastDay.Sub(today) < 7*24*time.Hour {
+		return fmt.Sprintf("out until %s, %s", lastDay.Format("Monday"), back)
+	}
+	return fmt.Sprintf("out until %s", lastDay.Format("Jan 2"))
+}
+
+func appendReturnText(ptoText string, ev Event, calendarFor CalendarFor) string {
+	if calendarFor == nil || !ev.IsAbsence(false) {
+		return ptoText
+	}
+	return fmt.Sprintf("%s (%s)\n", strings.TrimSuffix(ptoText, "\n"), returnText(ev, calendarFor(ev), time.Now().UTC()))
+}
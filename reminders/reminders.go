@@ -0,0 +1,151 @@
+package reminders
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/alert"
+	"github.com/jainmickey/justworks_integration/environment"
+	"github.com/jainmickey/justworks_integration/forecast"
+	"github.com/jainmickey/justworks_integration/holidays"
+	"github.com/jainmickey/justworks_integration/justworks"
+	"github.com/jainmickey/justworks_integration/slacknotifier"
+	"github.com/jainmickey/justworks_integration/state"
+	"github.com/jainmickey/justworks_integration/workcal"
+)
+
+const (
+	optOutsKey       = "reminder_opt_outs"
+	remindersSentKey = "reminders_sent"
+)
+
+// ---- Opt-outs are kept by lower case email in the state store ----
+
+func optOuts(store *state.Store) map[string]bool {
+	emails := map[string]bool{}
+	store.Get(optOutsKey, &emails)
+	return emails
+}
+
+func IsOptedOut(store *state.Store, email string) bool {
+	return optOuts(store)[strings.ToLower(email)]
+}
+
+func SetOptOut(store *state.Store, email string, optOut bool) error {
+	emails := optOuts(store)
+	if optOut {
+		emails[strings.ToLower(email)] = true
+	} else {
+		delete(emails, strings.ToLower(email))
+	}
+	return store.Set(optOutsKey, emails)
+}
+
+func OptedOut(store *state.Store) []string {
+	var emails []string
+	for email := range optOuts(store) {
+		emails = append(emails, email)
+	}
+	return emails
+}
+
+// reminderDay is the working day, workingDaysBefore working days before
+// the first day of leave, on which the reminder goes out.
+func reminderDay(firstDay time.Time, workingDaysBefore int, calendar workcal.Calendar) time.Time {
+	date := workcal.Day(firstDay)
+	for i := 0; i < workingDaysBefore; i++ {
+		date = calendar.PreviousWorkingDay(date)
+	}
+	return date
+}
+
+func assignmentsText(assignments []forecast.Assignment, projects map[int]forecast.Project, config *environment.Config) string {
+	var lines []string
+	for _, assignment := range assignments {
+		if assignment.IsTimeOff(config) {
+			continue
+		}
+		name := fmt.Sprintf("Project %d", assignment.ProjectID)
+		if project, ok := projects[assignment.ProjectID]; ok {
+			name = project.Name
+		}
+		lines = append(lines, fmt.Sprintf("- %s (%s – %s)", name, assignment.StartDate, assignment.EndDate))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n*Forecast assignments during your time off*:\n%s\n", strings.Join(lines, "\n"))
+}
+
+// CreateReminderMessage is the direct message for one person's upcoming PTO.
+func CreateReminderMessage(firstName string, ev justworks.Event, calendar workcal.Calendar, assignments string) string {
+	lastDay := ev.LastDay()
+	back := calendar.NextWorkingDay(lastDay)
+	messaging := fmt.Sprintf(":palm_tree: Hi %s, your %s starts %s and you're back %s.\n\n",
+		firstName, ev.DisplayType(), ev.StartDate().Format("Mon, 2 Jan"), back.Format("Mon, 2 Jan"))
+	messaging = fmt.Sprintf("%sBefore you go:\n- Set an out-of-office reply and your Slack status\n- Hand over anything that can't wait until you're back\n", messaging)
+	messaging = fmt.Sprintf("%s%s", messaging, assignments)
+	return fmt.Sprintf("%s\n_Don't want these reminders? Ask a BootBot admin to run `reminders -opt-out <your email>`._\n", messaging)
+}
+
+// SendReminders direct messages everyone whose leave starts in
+// WorkingDaysBefore of their own working days. Leave whose reminder day was
+// missed, because a run failed or it was booked late, is reminded about on
+// the next run before it starts. Each leave is reminded about once, and
+// people who opted out are skipped.
+func SendReminders(config *environment.Config, store *state.Store, alerter alert.Alerter, calendar *holidays.Calendar) {
+	if !config.Slack.Enabled {
+		fmt.Println("Slack isn't enabled, not sending reminders")
+		return
+	}
+	today := workcal.Day(time.Now())
+	eventsList, _ := justworks.GetByStartDate(today, config)
+	forecastPeople, _ := forecast.GetPeopleDetailsFromForecast(config, alerter)
+	client := slacknotifier.NewClient(config.Slack.BotToken.Value())
+
+	sent := map[string]time.Time{}
+	store.Get(remindersSentKey, &sent)
+	for key, firstDay := range sent {
+		if firstDay.Before(today) {
+			delete(sent, key)
+		}
+	}
+
+	var projects map[int]forecast.Project
+	for _, fp := range forecastPeople {
+		if !fp.IsActive() || len(fp.Email()) == 0 || IsOptedOut(store, fp.Email()) {
+			continue
+		}
+		workingCalendar := forecast.WorkingCalendar(fp, config.Holidays, calendar)
+		for _, ev := range forecast.EventsForPerson(fp, eventsList) {
+			if !ev.IsAbsence(false) || ev.IsCancelled() || ev.IsTentative() {
+				continue
+			}
+			firstDay := workcal.Day(ev.StartDate())
+			if !today.Before(firstDay) || reminderDay(firstDay, config.Reminders.WorkingDaysBefore, workingCalendar).After(today) {
+				continue
+			}
+			key := fmt.Sprintf("%s|%s|%s", strings.ToLower(fp.Email()), ev.UID(), ev.StartDate().Format("2006-01-02"))
+			if _, ok := sent[key]; ok {
+				continue
+			}
+
+			if projects == nil {
+				projects, _ = forecast.GetProjects(config)
+			}
+			assignments, err := forecast.GetAssignments(config, ev.StartDate(), ev.LastDay(), fp.ID())
+			if err != nil {
+				fmt.Println("Error in fetching Forecast assignments", fp.Email(), err)
+			}
+			message := CreateReminderMessage(fp.FirstName(), ev, workingCalendar, assignmentsText(assignments, projects, config))
+			fmt.Println("Reminder Message", fp.Email(), message)
+			if err := client.SendDirectMessage(fp.Email(), message); err != nil {
+				fmt.Println("Error in sending reminder", fp.Email(), err)
+				continue
+			}
+			sent[key] = firstDay
+		}
+	}
+	store.Set(remindersSentKey, sent)
+}
@@ -0,0 +1,160 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/justworks"
+	"github.com/jainmickey/justworks_integration/workcal"
+)
+
+const (
+	ByMonth   = "month"
+	ByQuarter = "quarter"
+	ByTotal   = "total"
+)
+
+type Row struct {
+	Person    string  `json:"person"`
+	Email     string  `json:"email"`
+	LeaveType string  `json:"leave_type"`
+	Period    string  `json:"period"`
+	Days      float64 `json:"days"`
+}
+
+// Report is PTO taken per person, leave type and period between From and
+// To (To not included), counted in working days.
+type Report struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	GroupBy string    `json:"group_by"`
+	Rows    []Row     `json:"rows"`
+}
+
+func periodOf(date time.Time, groupBy string) string {
+	switch groupBy {
+	case ByMonth:
+		return date.Format("2006-01")
+	case ByQuarter:
+		return fmt.Sprintf("%d-Q%d", date.Year(), (int(date.Month())-1)/3+1)
+	}
+	return ByTotal
+}
+
+// PersonFor names the person an event belongs to and gives their email,
+// which keeps people with the same "First L." apart.
+type PersonFor func(ev justworks.Event) (string, string)
+
+// Build counts every working day of every absence in the range. A partial
+// day counts as the fraction of an 8 hour day it takes.
+func Build(events []justworks.Event, from time.Time, to time.Time, groupBy string, calendarFor justworks.CalendarFor, personFor PersonFor) Report {
+	totals := map[Row]float64{}
+	for _, ev := range events {
+		if !ev.IsAbsence(true) || ev.IsCancelled() || ev.IsTentative() {
+			continue
+		}
+		calendar := calendarFor(ev)
+		name, email := personFor(ev)
+		dayFraction := ev.HoursPerDay() / justworks.WorkingHoursPerDay
+		for date := workcal.Day(ev.StartDate()); !date.After(ev.LastDay()); date = date.AddDate(0, 0, 1) {
+			if date.Before(workcal.Day(from)) || !date.Before(to) || !calendar.IsWorkingDay(date) {
+				continue
+			}
+			key := Row{Person: name, Email: email, LeaveType: ev.DisplayType(), Period: periodOf(date, groupBy)}
+			totals[key] += dayFraction
+		}
+	}
+
+	report := Report{From: from, To: to, GroupBy: groupBy}
+	for key, days := range totals {
+		key.Days = days
+		report.Rows = append(report.Rows, key)
+	}
+	sort.Slice(report.Rows, func(i, j int) bool {
+		a, b := report.Rows[i], report.Rows[j]
+		if a.Person != b.Person {
+			return a.Person < b.Person
+		}
+		if a.Email != b.Email {
+			return a.Email < b.Email
+		}
+		if a.Period != b.Period {
+			return a.Period < b.Period
+		}
+		return a.LeaveType < b.LeaveType
+	})
+	return report
+}
+
+func formatDays(days float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", days), "0"), ".")
+}
+
+func (r Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"person", "email", "leave_type", "period", "days"})
+	for _, row := range r.Rows {
+		writer.Write([]string{row.Person, row.Email, row.LeaveType, row.Period, formatDays(row.Days)})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (r Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// SlackSummary totals each person's days with a per leave type breakdown,
+// most days first.
+func (r Report) SlackSummary() string {
+	type person struct{ name, email string }
+	perPerson := map[person]map[string]float64{}
+	totals := map[person]float64{}
+	for _, row := range r.Rows {
+		key := person{row.Person, row.Email}
+		if _, ok := perPerson[key]; !ok {
+			perPerson[key] = map[string]float64{}
+		}
+		perPerson[key][row.LeaveType] += row.Days
+		totals[key] += row.Days
+	}
+	var people []person
+	for key := range perPerson {
+		people = append(people, key)
+	}
+	sort.Slice(people, func(i, j int) bool {
+		if totals[people[i]] != totals[people[j]] {
+			return totals[people[i]] > totals[people[j]]
+		}
+		if people[i].name != people[j].name {
+			return people[i].name < people[j].name
+		}
+		return people[i].email < people[j].email
+	})
+
+	messaging := fmt.Sprintf(":bar_chart: *PTO taken %s – %s* (working days):\n\n",
+		r.From.Format("2 Jan 2006"), r.To.AddDate(0, 0, -1).Format("2 Jan 2006"))
+	if len(people) == 0 {
+		return fmt.Sprintf("%sNo PTO in this period.\n", messaging)
+	}
+	for _, key := range people {
+		var types []string
+		for leaveType := range perPerson[key] {
+			types = append(types, leaveType)
+		}
+		sort.Strings(types)
+		var breakdown []string
+		for _, leaveType := range types {
+			breakdown = append(breakdown, fmt.Sprintf("%s %s", leaveType, formatDays(perPerson[key][leaveType])))
+		}
+		messaging = fmt.Sprintf("%s- %s: %s (%s)\n", messaging, key.name, formatDays(totals[key]), strings.Join(breakdown, ", "))
+	}
+	return messaging
+}
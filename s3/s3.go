@@ -1,10 +1,12 @@
 package s3
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -68,6 +70,27 @@ func UploadFile(bucketName string, filename string) (bool, error) {
 	return true, nil
 }
 
+// UploadObject writes body to key, for files that aren't kept on disk like
+// the published calendar feeds.
+func UploadObject(bucketName string, key string, body []byte, contentType string) (bool, error) {
+	sess, err := getNewSession()
+	uploader := s3manager.NewUploader(sess)
+
+	_, err = uploader.Upload(&s3manager.UploadInput{
+		Bucket:      aws.String(bucketName),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		fmt.Printf("Unable to upload %q to %q, %v\n", key, bucketName, err)
+		return false, err
+	}
+
+	fmt.Printf("Successfully uploaded %q to %q\n", key, bucketName)
+	return true, nil
+}
+
 func DownloadFile(bucketName string, filename string) (bool, error) {
 	// Remove file locally if already exists
 	_, err := os.Stat(filename)
@@ -98,3 +121,11 @@ func DownloadFile(bucketName string, filename string) (bool, error) {
 	fmt.Println("Downloaded", file.Name(), numBytes, "bytes")
 	return true, nil
 }
+
+// IsNotFound reports whether err is S3 saying the key doesn't exist yet.
+func IsNotFound(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound"
+	}
+	return false
+}
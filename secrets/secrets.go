@@ -0,0 +1,224 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+const ssmScheme = "ssm"
+const secretsManagerScheme = "secretsmanager"
+
+var cacheTTL = time.Hour
+
+// Provider looks up a single secret. The reference is the part after the
+// scheme, e.g. "/bootbot/forecast_token" for "ssm:/bootbot/forecast_token".
+type Provider interface {
+	Get(reference string) (string, error)
+}
+
+func IsReference(value string) bool {
+	scheme, _, ok := splitReference(value)
+	return ok && (scheme == ssmScheme || scheme == secretsManagerScheme)
+}
+
+func splitReference(value string) (string, string, bool) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || len(parts[1]) == 0 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+func getRegion() string {
+	if region, ok := os.LookupEnv("AWS_REGION"); ok && len(region) > 0 {
+		return region
+	}
+	return "us-west-2"
+}
+
+func getNewSession() (*session.Session, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(getRegion())},
+	)
+	return sess, err
+}
+
+// ---------- SSM Parameter Store -----------------------------------------------
+
+type SSMProvider struct {
+	client *ssm.SSM
+}
+
+func (p *SSMProvider) Get(reference string) (string, error) {
+	if p.client == nil {
+		sess, err := getNewSession()
+		if err != nil {
+			return "", err
+		}
+		p.client = ssm.New(sess)
+	}
+	resp, err := p.client.GetParameter(&ssm.GetParameterInput{
+		Name:           aws.String(reference),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	if resp.Parameter == nil || resp.Parameter.Value == nil {
+		return "", fmt.Errorf("parameter %s has no value", reference)
+	}
+	return *resp.Parameter.Value, nil
+}
+
+// ---------- Secrets Manager ---------------------------------------------------
+
+// SecretsManagerProvider resolves "secret-id" to the whole SecretString and
+// "secret-id#key" to one key of a JSON SecretString.
+type SecretsManagerProvider struct {
+	client *secretsmanager.SecretsManager
+}
+
+func (p *SecretsManagerProvider) Get(reference string) (string, error) {
+	if p.client == nil {
+		sess, err := getNewSession()
+		if err != nil {
+			return "", err
+		}
+		p.client = secretsmanager.New(sess)
+	}
+	secretID, key := reference, ""
+	if index := strings.Index(reference, "#"); index >= 0 {
+		secretID, key = reference[:index], reference[index+1:]
+	}
+	resp, err := p.client.GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretID),
+	})
+	if err != nil {
+		return "", err
+	}
+	if resp.SecretString == nil {
+		return "", fmt.Errorf("secret %s has no string value", secretID)
+	}
+	if len(key) == 0 {
+		return *resp.SecretString, nil
+	}
+	var values map[string]string
+	if err := json.Unmarshal([]byte(*resp.SecretString), &values); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object: %s", secretID, err.Error())
+	}
+	if val, ok := values[key]; ok {
+		return val, nil
+	}
+	return "", fmt.Errorf("secret %s has no key %s", secretID, key)
+}
+
+// ---------- Local file stub ---------------------------------------------------
+
+// FileProvider serves secrets from a JSON file mapping full references to
+// values, so local runs work offline:
+//   {"ssm:/bootbot/forecast_token": "...", "secretsmanager:bootbot#slack": "..."}
+type FileProvider struct {
+	scheme string
+	values map[string]string
+}
+
+func loadSecretsFile(filename string) (map[string]string, error) {
+	file, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Can't read secrets file %s: %s", filename, err.Error())
+	}
+	values := map[string]string{}
+	if err := json.Unmarshal(file, &values); err != nil {
+		return nil, fmt.Errorf("Can't parse secrets file %s: %s", filename, err.Error())
+	}
+	return values, nil
+}
+
+func (p *FileProvider) Get(reference string) (string, error) {
+	key := fmt.Sprintf("%s:%s", p.scheme, reference)
+	if val, ok := p.values[key]; ok {
+		return val, nil
+	}
+	return "", fmt.Errorf("%s not found in secrets file", key)
+}
+
+// ---------- Resolver ----------------------------------------------------------
+
+type cachedSecret struct {
+	value     string
+	fetchedAt time.Time
+}
+
+type Resolver struct {
+	providers map[string]Provider
+	cache     map[string]cachedSecret
+	mutex     sync.Mutex
+}
+
+func NewResolver(providers map[string]Provider) *Resolver {
+	return &Resolver{
+		providers: providers,
+		cache:     map[string]cachedSecret{},
+	}
+}
+
+// Resolve returns plain values unchanged and looks up secret references,
+// caching them so warm Lambda invocations don't refetch on every run.
+func (r *Resolver) Resolve(value string) (string, error) {
+	if IsReference(value) == false {
+		return value, nil
+	}
+	scheme, reference, _ := splitReference(value)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if cached, ok := r.cache[value]; ok && time.Since(cached.fetchedAt) < cacheTTL {
+		return cached.value, nil
+	}
+	provider, ok := r.providers[scheme]
+	if !ok {
+		return "", errors.New(fmt.Sprintf("No secret provider for %s", scheme))
+	}
+	secret, err := provider.Get(reference)
+	if err != nil {
+		return "", fmt.Errorf("Can't resolve %s: %s", value, err.Error())
+	}
+	r.cache[value] = cachedSecret{value: secret, fetchedAt: time.Now()}
+	return secret, nil
+}
+
+var defaultResolver *Resolver
+
+// DefaultResolver uses AWS unless $BootBotSecretsFile names a local stub file.
+func DefaultResolver() (*Resolver, error) {
+	if defaultResolver != nil {
+		return defaultResolver, nil
+	}
+	if filename, ok := os.LookupEnv("BootBotSecretsFile"); ok && len(filename) > 0 {
+		values, err := loadSecretsFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		defaultResolver = NewResolver(map[string]Provider{
+			ssmScheme:            &FileProvider{scheme: ssmScheme, values: values},
+			secretsManagerScheme: &FileProvider{scheme: secretsManagerScheme, values: values},
+		})
+		return defaultResolver, nil
+	}
+	defaultResolver = NewResolver(map[string]Provider{
+		ssmScheme:            &SSMProvider{},
+		secretsManagerScheme: &SecretsManagerProvider{},
+	})
+	return defaultResolver, nil
+}
@@ -4,20 +4,27 @@ import (
 	"fmt"
 	"log"
 	"net/smtp"
+
+	"github.com/jainmickey/justworks_integration/environment"
 )
 
 func SendEmailSMTP(from string, to string, subject string, body string,
-	envVars map[string]string) (string, error) {
+	emailConfig environment.EmailConfig) (string, error) {
+
+	if emailConfig.Enabled == false {
+		log.Printf("Email disabled, not sending: %s", subject)
+		return "", nil
+	}
 
-	host := fmt.Sprintf("%s:%s", envVars["EmailHost"], envVars["EmailPort"])
-	fmt.Println("Testing", host, envVars["EmailHostUser"], envVars["EmailHostPassword"], envVars["EmailPort"])
+	host := fmt.Sprintf("%s:%s", emailConfig.Host, emailConfig.Port)
+	fmt.Println("Sending email via", host, emailConfig.User)
 	msg := "From: " + from + "\n" +
 		"To: " + to + "\n" +
 		"Subject: " + subject + "\n\n" +
 		body
 
 	err := smtp.SendMail(host,
-		smtp.PlainAuth("", envVars["EmailHostUser"], envVars["EmailHostPassword"], envVars["EmailHost"]),
+		smtp.PlainAuth("", emailConfig.User, emailConfig.Password.Value(), emailConfig.Host),
 		from, []string{to}, []byte(msg))
 
 	if err != nil {
@@ -0,0 +1,133 @@
+package slacknotifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+const apiURL = "https://slack.com/api"
+
+// Client talks to the Slack Web API with a bot token, for what webhooks
+// can't do like direct messages.
+type Client struct {
+	token  string
+	apiURL string
+	http   *http.Client
+}
+
+func NewClient(token string) Client {
+	return Client{token: token, apiURL: apiURL, http: &http.Client{}}
+}
+
+type apiResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+func (c Client) do(req *http.Request, result interface{}) error {
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var status apiResponse
+	if err := json.Unmarshal(body, &status); err != nil {
+		return fmt.Errorf("Slack %s: %s", req.URL.Path, resp.Status)
+	}
+	if !status.OK {
+		return fmt.Errorf("Slack %s: %s", req.URL.Path, status.Error)
+	}
+	if result != nil {
+		return json.Unmarshal(body, result)
+	}
+	return nil
+}
+
+// Call posts a JSON payload to a Web API method such as chat.postMessage.
+func (c Client) Call(method string, payload interface{}, result interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/%s", c.apiURL, method), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	return c.do(req, result)
+}
+
+// Get calls a read method such as users.lookupByEmail with query params.
+func (c Client) Get(method string, params url.Values, result interface{}) error {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s?%s", c.apiURL, method, params.Encode()), nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, result)
+}
+
+func (c Client) LookupUserByEmail(email string) (string, error) {
+	var result struct {
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	}
+	err := c.Get("users.lookupByEmail", url.Values{"email": {email}}, &result)
+	return result.User.ID, err
+}
+
+// PostMessage posts text to a channel, or to a user's DM with the app when
+// channel is a user ID.
+func (c Client) PostMessage(channel string, text string) error {
+	return c.Call("chat.postMessage", map[string]string{"channel": channel, "text": text}, nil)
+}
+
+func (c Client) SendDirectMessage(email string, text string) error {
+	userID, err := c.LookupUserByEmail(email)
+	if err != nil {
+		return err
+	}
+	return c.PostMessage(userID, text)
+}
+
+type Status struct {
+	Text       string `json:"status_text"`
+	Emoji      string `json:"status_emoji"`
+	Expiration int64  `json:"status_expiration"`
+}
+
+func (c Client) GetStatus(userID string) (Status, error) {
+	var result struct {
+		Profile Status `json:"profile"`
+	}
+	err := c.Get("users.profile.get", url.Values{"user": {userID}}, &result)
+	return result.Profile, err
+}
+
+// SetStatus changes someone else's status, which takes a user token of a
+// workspace admin. Slack clears it by itself at Expiration (Unix time, 0
+// for never).
+func (c Client) SetStatus(userID string, status Status) error {
+	return c.Call("users.profile.set", map[string]interface{}{"user": userID, "profile": status}, nil)
+}
+
+func (c Client) UserEmail(userID string) (string, error) {
+	var result struct {
+		User struct {
+			Profile struct {
+				Email string `json:"email"`
+			} `json:"profile"`
+		} `json:"user"`
+	}
+	err := c.Get("users.info", url.Values{"user": {userID}}, &result)
+	return result.User.Profile.Email, err
+}
@@ -0,0 +1,112 @@
+package slacknotifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// sectionLimit is the most text Slack takes in one section block.
+const sectionLimit = 3000
+
+type Text struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func Markdown(text string) *Text {
+	return &Text{Type: "mrkdwn", Text: text}
+}
+
+func PlainText(text string) *Text {
+	return &Text{Type: "plain_text", Text: text}
+}
+
+// Block is a Block Kit block, only the fields the bot uses.
+type Block struct {
+	Type     string    `json:"type"`
+	BlockID  string    `json:"block_id,omitempty"`
+	Text     *Text     `json:"text,omitempty"`
+	Elements []Element `json:"elements,omitempty"`
+}
+
+// Element is a Block Kit button.
+type Element struct {
+	Type     string `json:"type"`
+	Text     *Text  `json:"text"`
+	ActionID string `json:"action_id"`
+	Value    string `json:"value,omitempty"`
+	Style    string `json:"style,omitempty"`
+}
+
+func Button(actionID string, label string, value string) Element {
+	return Element{Type: "button", Text: PlainText(label), ActionID: actionID, Value: value}
+}
+
+func Actions(blockID string, buttons ...Element) Block {
+	return Block{Type: "actions", BlockID: blockID, Elements: buttons}
+}
+
+// Sections splits text into section blocks at line breaks so each fits.
+func Sections(text string) []Block {
+	var blocks []Block
+	var current strings.Builder
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if current.Len()+len(line) > sectionLimit && current.Len() > 0 {
+			blocks = append(blocks, Block{Type: "section", Text: Markdown(current.String())})
+			current.Reset()
+		}
+		current.WriteString(line)
+	}
+	if len(strings.TrimSpace(current.String())) > 0 {
+		blocks = append(blocks, Block{Type: "section", Text: Markdown(current.String())})
+	}
+	return blocks
+}
+
+// Message is a message with blocks. Text is the fallback for
+// notifications. The response fields are for replies to interactions.
+type Message struct {
+	Text            string  `json:"text"`
+	Blocks          []Block `json:"blocks,omitempty"`
+	ResponseType    string  `json:"response_type,omitempty"`
+	ReplaceOriginal bool    `json:"replace_original,omitempty"`
+}
+
+func postJSON(postURL string, value interface{}) error {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", postURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("Can't connect to host %s: %s", postURL, err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Slack responded %s", resp.Status)
+	}
+	return nil
+}
+
+func (slack Slack) NotifyMessage(message Message) error {
+	return postJSON(slack.webHook, message)
+}
+
+// Respond answers an interaction through its response_url.
+func Respond(responseURL string, message Message) error {
+	return postJSON(responseURL, message)
+}
+
+// PostBlocks posts a message with blocks to a channel or a user's DM.
+func (c Client) PostBlocks(channel string, message Message) error {
+	return c.Call("chat.postMessage", map[string]interface{}{"channel": channel, "text": message.Text, "blocks": message.Blocks}, nil)
+}
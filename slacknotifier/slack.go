@@ -1,9 +1,10 @@
 package slacknotifier
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/http"
-	"strings"
 )
 
 type Slack struct {
@@ -28,9 +29,12 @@ func (slack *Slack) Face(face string) {
 }
 
 func (slack Slack) Notify(text string) error {
-	json := fmt.Sprintf(`{"text":"%s"}`, text)
+	payload, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
 
-	req, err := http.NewRequest("POST", slack.webHook, strings.NewReader(json))
+	req, err := http.NewRequest("POST", slack.webHook, bytes.NewReader(payload))
 	if err != nil {
 		return fmt.Errorf("Can't connect to host %s: %s", slack.webHook, err.Error())
 	}
@@ -0,0 +1,39 @@
+package slacknotifier
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxRequestAge guards against replayed requests.
+const maxRequestAge = 5 * time.Minute
+
+// VerifyRequest checks the X-Slack-Signature of a request Slack sent, body
+// being the raw request body.
+func VerifyRequest(header http.Header, body []byte, signingSecret string, now time.Time) error {
+	if len(signingSecret) == 0 {
+		return fmt.Errorf("no signing secret configured")
+	}
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad request timestamp %q", timestamp)
+	}
+	if math.Abs(now.Sub(time.Unix(seconds, 0)).Seconds()) > maxRequestAge.Seconds() {
+		return fmt.Errorf("request timestamp too old")
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	expected := fmt.Sprintf("v0=%s", hex.EncodeToString(mac.Sum(nil)))
+	if !hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature"))) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package slacknotifier
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Slack's example from "Verifying requests from Slack".
+const (
+	exampleSecret    = "8f742231b10e8888abcd99yyyzzz85a5"
+	exampleTimestamp = "1531420618"
+	exampleSignature = "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503"
+	exampleBody      = "token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c"
+)
+
+func TestVerifyRequest(t *testing.T) {
+	sent := time.Unix(1531420618, 0)
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      string
+		now       time.Time
+		valid     bool
+	}{
+		{"slack example", exampleSecret, exampleTimestamp, exampleSignature, exampleBody, sent.Add(time.Minute), true},
+		{"stale timestamp", exampleSecret, exampleTimestamp, exampleSignature, exampleBody, sent.Add(6 * time.Minute), false},
+		{"timestamp from the future", exampleSecret, exampleTimestamp, exampleSignature, exampleBody, sent.Add(-6 * time.Minute), false},
+		{"bad signature", exampleSecret, exampleTimestamp, "v0=" + exampleSignature[4:] + "0", exampleBody, sent, false},
+		{"changed body", exampleSecret, exampleTimestamp, exampleSignature, exampleBody + "&text=x", sent, false},
+		{"wrong secret", "not-the-secret", exampleTimestamp, exampleSignature, exampleBody, sent, false},
+		{"no secret", "", exampleTimestamp, exampleSignature, exampleBody, sent, false},
+		{"no timestamp", exampleSecret, "", exampleSignature, exampleBody, sent, false},
+		{"no signature", exampleSecret, exampleTimestamp, "", exampleBody, sent, false},
+	}
+	for _, test := range tests {
+		header := http.Header{}
+		header.Set("X-Slack-Request-Timestamp", test.timestamp)
+		header.Set("X-Slack-Signature", test.signature)
+		err := VerifyRequest(header, []byte(test.body), test.secret, test.now)
+		if test.valid && err != nil {
+			t.Errorf("%s: expected valid, got %s", test.name, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/jainmickey/justworks_integration/s3"
+)
+
+const stateFile = "/tmp/globalState.json"
+
+// Store is a small JSON document kept in S3 between Lambda runs. Every
+// feature keeps its own top level key in it.
+type Store struct {
+	bucket   string
+	filename string
+	data     map[string]json.RawMessage
+	// loaded is false when the last Reload failed, Save then refuses to
+	// upload the empty document over the real one.
+	loaded bool
+}
+
+func Load(bucket string) (*Store, error) {
+	store := &Store{bucket: bucket, filename: stateFile, data: map[string]json.RawMessage{}}
+	return store, store.Reload()
+}
+
+// Reload replaces the data with the latest copy in S3, for long running
+// processes that share the document with the Lambda. Only a missing
+// document starts fresh, any other failure is returned.
+func (st *Store) Reload() error {
+	st.data = map[string]json.RawMessage{}
+	st.loaded = false
+	_, err := s3.DownloadFile(st.bucket, st.filename)
+	if err != nil {
+		if !s3.IsNotFound(err) {
+			return fmt.Errorf("Error in downloading state: %s", err)
+		}
+		fmt.Println("No state file, starting fresh: ", err)
+		st.loaded = true
+		return nil
+	}
+	file, err := ioutil.ReadFile(st.filename)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(file, &st.data)
+	if err != nil {
+		fmt.Println("Error in json unmarshell error: ", err)
+		st.data = map[string]json.RawMessage{}
+		return err
+	}
+	st.loaded = true
+	return nil
+}
+
+// ReloadKeys replaces only keys with their latest copy in S3, so a save
+// keeps what another process wrote to them since Load.
+func (st *Store) ReloadKeys(keys ...string) error {
+	latest := &Store{bucket: st.bucket, filename: st.filename}
+	if err := latest.Reload(); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if raw, ok := latest.data[key]; ok {
+			st.data[key] = raw
+		} else {
+			delete(st.data, key)
+		}
+	}
+	return nil
+}
+
+// Get decodes key into value and reports whether the key was present.
+func (st *Store) Get(key string, value interface{}) bool {
+	raw, ok := st.data[key]
+	if !ok {
+		return false
+	}
+	err := json.Unmarshal(raw, value)
+	if err != nil {
+		fmt.Println("Error in reading state", key, err)
+		return false
+	}
+	return true
+}
+
+func (st *Store) Set(key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	st.data[key] = raw
+	return nil
+}
+
+func (st *Store) Delete(key string) {
+	delete(st.data, key)
+}
+
+func (st *Store) Save() error {
+	if !st.loaded {
+		return fmt.Errorf("State wasn't loaded, not saving over it")
+	}
+	file, err := json.Marshal(st.data)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(st.filename, file, 0644)
+	if err != nil {
+		return err
+	}
+	s3FileUploadStatus, err := s3.UploadFile(st.bucket, st.filename)
+	if s3FileUploadStatus == false {
+		fmt.Println("Error in uploading s3 file: ", err)
+		return err
+	}
+	return nil
+}
+
+// SaveFile keeps a copy of a local file next to the state document.
+func (st *Store) SaveFile(filename string) error {
+	s3FileUploadStatus, err := s3.UploadFile(st.bucket, filename)
+	if s3FileUploadStatus == false {
+		return err
+	}
+	return nil
+}
+
+// RestoreFile fetches a copy previously kept with SaveFile.
+func (st *Store) RestoreFile(filename string) error {
+	s3FileDownloadStatus, err := s3.DownloadFile(st.bucket, filename)
+	if s3FileDownloadStatus == false {
+		return err
+	}
+	return nil
+}
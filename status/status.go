@@ -0,0 +1,117 @@
+package status
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/alert"
+	"github.com/jainmickey/justworks_integration/environment"
+	"github.com/jainmickey/justworks_integration/forecast"
+	"github.com/jainmickey/justworks_integration/holidays"
+	"github.com/jainmickey/justworks_integration/justworks"
+	"github.com/jainmickey/justworks_integration/slacknotifier"
+	"github.com/jainmickey/justworks_integration/state"
+	"github.com/jainmickey/justworks_integration/workcal"
+)
+
+// statusesSetKey remembers the status we set for each email, so it's only
+// cleared or replaced while it's still ours.
+const statusesSetKey = "slack_statuses_set"
+
+// todaysEvent picks what to show for today: a full day absence wins over
+// working remotely, partial days aren't shown.
+func todaysEvent(events []justworks.Event, today time.Time) (justworks.Event, bool) {
+	var picked justworks.Event
+	found := false
+	for _, ev := range events {
+		if ev.IsPartialDay() || ev.IsCancelled() || ev.IsTentative() {
+			continue
+		}
+		if today.Before(workcal.Day(ev.StartDate())) || today.After(ev.LastDay()) {
+			continue
+		}
+		if !found || (ev.IsAbsence(true) && !picked.IsAbsence(true)) {
+			picked = ev
+			found = true
+		}
+	}
+	return picked, found
+}
+
+// StatusFor is e.g. ":beach_with_umbrella: Vacation until Fri 6 Nov",
+// expiring when the person is back so Slack clears it even if we don't run.
+func StatusFor(ev justworks.Event, calendar workcal.Calendar) slacknotifier.Status {
+	back := calendar.NextWorkingDay(ev.LastDay())
+	text := ev.DisplayType()
+	if ev.LastDay().After(workcal.Day(ev.StartDate())) {
+		text = fmt.Sprintf("%s until %s", text, ev.LastDay().Format("Mon 2 Jan"))
+	}
+	return slacknotifier.Status{Text: text, Emoji: ev.Emoji(), Expiration: back.Unix()}
+}
+
+// SyncStatuses sets the Slack status of everyone away today and clears the
+// ones we set for people who are back. A status someone set themselves is
+// never touched.
+func SyncStatuses(config *environment.Config, store *state.Store, alerter alert.Alerter, calendar *holidays.Calendar) {
+	today := workcal.Day(time.Now())
+	eventsList, _ := justworks.GetOverlapping(today, today.AddDate(0, 0, 1), config)
+	eventsList, _ = justworks.FilterEventsForVacationAndRemote(eventsList)
+	forecastPeople, _ := forecast.GetPeopleDetailsFromForecast(config, alerter)
+	client := slacknotifier.NewClient(config.Slack.UserToken.Value())
+
+	statusesSet := map[string]slacknotifier.Status{}
+	store.Get(statusesSetKey, &statusesSet)
+
+	for _, fp := range forecastPeople {
+		email := strings.ToLower(fp.Email())
+		if !fp.IsActive() || len(email) == 0 {
+			continue
+		}
+		ev, away := todaysEvent(forecast.EventsForPerson(fp, eventsList), today)
+		ours, haveOurs := statusesSet[email]
+		if !away && !haveOurs {
+			continue
+		}
+
+		userID, err := client.LookupUserByEmail(email)
+		if err != nil {
+			fmt.Println("Error in finding Slack user", email, err)
+			continue
+		}
+		current, err := client.GetStatus(userID)
+		if err != nil {
+			fmt.Println("Error in reading Slack status", email, err)
+			continue
+		}
+		isOurs := haveOurs && current.Text == ours.Text && current.Emoji == ours.Emoji
+		if len(current.Text) > 0 && !isOurs {
+			// ---- Someone else's status, stop tracking ours ----
+			delete(statusesSet, email)
+			continue
+		}
+
+		wanted := slacknotifier.Status{}
+		if away {
+			wanted = StatusFor(ev, forecast.WorkingCalendar(fp, config.Holidays, calendar))
+		}
+		if wanted.Text == current.Text && wanted.Emoji == current.Emoji {
+			// ---- Slack already cleared it at the expiration ----
+			if !away {
+				delete(statusesSet, email)
+			}
+			continue
+		}
+		fmt.Println("Setting Slack status", email, wanted.Text)
+		if err := client.SetStatus(userID, wanted); err != nil {
+			fmt.Println("Error in setting Slack status", email, err)
+			continue
+		}
+		if away {
+			statusesSet[email] = wanted
+		} else {
+			delete(statusesSet, email)
+		}
+	}
+	store.Set(statusesSetKey, statusesSet)
+}
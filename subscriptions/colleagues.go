@@ -0,0 +1,170 @@
+package subscriptions
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/environment"
+	"github.com/jainmickey/justworks_integration/forecast"
+	"github.com/jainmickey/justworks_integration/justworks"
+	"github.com/jainmickey/justworks_integration/slacknotifier"
+	"github.com/jainmickey/justworks_integration/state"
+	"github.com/jainmickey/justworks_integration/workcal"
+)
+
+const noticesLastRunKey = "colleague_notices_last_run"
+
+// recipient is who gets the direct message, by Slack user ID for follows
+// made in Slack or by email for the ones in the config.
+type recipient struct {
+	userID string
+	email  string
+}
+
+type watcher struct {
+	recipient recipient
+	follow    Follow
+}
+
+// watchers are the follows from the state store and the config. Config
+// follows go to the Slack user ID when the subscriber is known by email,
+// so nobody gets two messages.
+func watchers(store *state.Store, config environment.SubscriptionsConfig) []watcher {
+	var list []watcher
+	userIDs := map[string]string{}
+	for userID, preferences := range All(store) {
+		if len(preferences.Email) > 0 {
+			userIDs[strings.ToLower(preferences.Email)] = userID
+		}
+		for _, follow := range preferences.Following {
+			list = append(list, watcher{recipient: recipient{userID: userID}, follow: follow})
+		}
+	}
+	for _, follow := range config.Follows {
+		to := recipient{userID: userIDs[strings.ToLower(follow.Subscriber)], email: follow.Subscriber}
+		if len(to.userID) > 0 {
+			to.email = ""
+		}
+		list = append(list, watcher{recipient: to, follow: Follow{Email: follow.Colleague, Label: follow.Label}})
+	}
+	return list
+}
+
+// matches uses the attendee emails on the event, or Forecast's name
+// matching for events without them.
+func (w watcher) matches(ev justworks.Event, people []forecast.ForecastPerson) bool {
+	if !ev.IsAbsence(true) {
+		return false
+	}
+	if ev.HasEmail(w.follow.Email) {
+		return true
+	}
+	for _, fp := range people {
+		if strings.EqualFold(fp.Email(), w.follow.Email) {
+			return len(forecast.EventsForPerson(fp, []justworks.Event{ev})) > 0
+		}
+	}
+	return false
+}
+
+// colleague is "Your pair " when there's a label, to go before the name.
+func (w watcher) colleague() string {
+	if len(w.follow.Label) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Your %s ", w.follow.Label)
+}
+
+// notices are the lines about one followed colleague: PTO they booked,
+// moved or cancelled since the last run and PTO that started after since,
+// so leave starting on a day without a run is still told about.
+func (w watcher) notices(changes justworks.Changes, events []justworks.Event, people []forecast.ForecastPerson, since time.Time, today time.Time) []string {
+	var lines []string
+	for _, ev := range changes.New {
+		if w.matches(ev, people) {
+			lines = append(lines, fmt.Sprintf(":new: %s%s booked %s - %s", w.colleague(), ev.Name(), ev.DisplayType(), justworks.DescribeDates(ev)))
+		}
+	}
+	for _, change := range changes.Moved {
+		if w.matches(change.Current, people) {
+			lines = append(lines, fmt.Sprintf(":arrows_counterclockwise: %s%s", w.colleague(), justworks.DescribeMove(change)))
+		}
+	}
+	for _, ev := range changes.Cancelled {
+		if w.matches(ev, people) {
+			lines = append(lines, fmt.Sprintf(":x: %s%s cancelled %s - %s", w.colleague(), ev.Name(), ev.DisplayType(), justworks.DescribeDates(ev)))
+		}
+	}
+	for _, ev := range events {
+		if ev.IsCancelled() || ev.IsTentative() {
+			continue
+		}
+		firstDay := workcal.Day(ev.StartDate())
+		if !firstDay.After(since) || firstDay.After(today) || workcal.Day(ev.LastDay()).Before(today) || !w.matches(ev, people) {
+			continue
+		}
+		when := "from today"
+		if firstDay.Before(today) {
+			when = fmt.Sprintf("since %s", firstDay.Format("Monday"))
+		}
+		lines = append(lines, fmt.Sprintf("%s %s%s is out %s - %s", ev.Emoji(), w.colleague(), ev.Name(), when, justworks.DescribeDates(ev)))
+	}
+	return lines
+}
+
+// NotifyFollowers direct messages everyone about the colleagues they
+// follow, one message each. The first run only covers leave starting today.
+func NotifyFollowers(config *environment.Config, store *state.Store, people []forecast.ForecastPerson, changes justworks.Changes) {
+	today := workcal.Day(time.Now().UTC())
+	since := today.AddDate(0, 0, -1)
+	var lastRun time.Time
+	if store.Get(noticesLastRunKey, &lastRun) {
+		since = workcal.Day(lastRun)
+	}
+	var events []justworks.Event
+	if since.Before(today) {
+		var err error
+		events, err = justworks.GetOverlapping(since, today.AddDate(0, 0, 1), config)
+		if err != nil {
+			fmt.Println("Error in reading events for colleague notices", err)
+		}
+	}
+
+	var order []recipient
+	notices := map[recipient][]string{}
+	for _, w := range watchers(store, config.Subscriptions) {
+		for _, line := range w.notices(changes, events, people, since, today) {
+			if _, ok := notices[w.recipient]; !ok {
+				order = append(order, w.recipient)
+			}
+			if !containsLine(notices[w.recipient], line) {
+				notices[w.recipient] = append(notices[w.recipient], line)
+			}
+		}
+	}
+
+	client := slacknotifier.NewClient(config.Slack.BotToken.Value())
+	for _, to := range order {
+		text := strings.Join(notices[to], "\n")
+		var err error
+		if len(to.userID) > 0 {
+			err = client.PostMessage(to.userID, text)
+		} else {
+			err = client.SendDirectMessage(to.email, text)
+		}
+		if err != nil {
+			fmt.Println("Error in sending colleague notices", to.userID, to.email, err)
+		}
+	}
+	store.Set(noticesLastRunKey, today)
+}
+
+func containsLine(lines []string, line string) bool {
+	for _, existing := range lines {
+		if existing == line {
+			return true
+		}
+	}
+	return false
+}
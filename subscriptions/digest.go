@@ -0,0 +1,40 @@
+package subscriptions
+
+import (
+	"fmt"
+
+	"github.com/jainmickey/justworks_integration/slacknotifier"
+	"github.com/jainmickey/justworks_integration/state"
+)
+
+// Action IDs of the digest buttons, handled by the API server.
+const (
+	ShowFullWeekAction = "show_full_week"
+	OnlyMyTeamAction   = "only_my_team"
+	SubscribeAction    = "subscribe_dms"
+	UnsubscribeAction  = "unsubscribe_dms"
+)
+
+// DigestMessage is the digest text with the buttons under it. The copy
+// sent as a direct message offers to unsubscribe instead.
+func DigestMessage(text string, directMessage bool) slacknotifier.Message {
+	subscribe := slacknotifier.Button(SubscribeAction, "Subscribe to DMs", "")
+	if directMessage {
+		subscribe = slacknotifier.Button(UnsubscribeAction, "Unsubscribe", "")
+	}
+	blocks := slacknotifier.Sections(text)
+	blocks = append(blocks, slacknotifier.Actions("digest",
+		slacknotifier.Button(ShowFullWeekAction, "Show full week", ""),
+		slacknotifier.Button(OnlyMyTeamAction, "Only my team", ""),
+		subscribe))
+	return slacknotifier.Message{Text: text, Blocks: blocks}
+}
+
+// SendDigestDMs sends the digest to everyone who subscribed.
+func SendDigestDMs(client slacknotifier.Client, store *state.Store, text string) {
+	for _, userID := range DigestSubscribers(store) {
+		if err := client.PostBlocks(userID, DigestMessage(text, true)); err != nil {
+			fmt.Println("Error in sending digest to", userID, err)
+		}
+	}
+}
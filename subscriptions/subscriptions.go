@@ -0,0 +1,95 @@
+package subscriptions
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jainmickey/justworks_integration/state"
+)
+
+const preferencesKey = "slack_user_preferences"
+
+// Preferences are what someone chose with the digest buttons and /ooo, kept by
+// Slack user ID in the state store.
+type Preferences struct {
+	Email     string   `json:"email,omitempty"`
+	DigestDM  bool     `json:"digest_dm"`
+	Following []Follow `json:"following,omitempty"`
+}
+
+// Follow is a colleague someone wants to hear about, by email. Label says
+// who they are to them, e.g. "pair".
+type Follow struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+	Label string `json:"label,omitempty"`
+}
+
+func All(store *state.Store) map[string]Preferences {
+	preferences := map[string]Preferences{}
+	store.Get(preferencesKey, &preferences)
+	return preferences
+}
+
+func Get(store *state.Store, userID string) Preferences {
+	return All(store)[userID]
+}
+
+func Set(store *state.Store, userID string, preferences Preferences) error {
+	all := All(store)
+	if !preferences.DigestDM && len(preferences.Following) == 0 {
+		delete(all, userID)
+	} else {
+		all[userID] = preferences
+	}
+	return store.Set(preferencesKey, all)
+}
+
+// ReloadPreferences takes the latest preferences from S3 before the Lambda
+// saves, only the API server changes them.
+func ReloadPreferences(store *state.Store) error {
+	return store.ReloadKeys(preferencesKey)
+}
+
+// DigestSubscribers are the Slack user IDs that get the daily digest as a
+// direct message.
+func DigestSubscribers(store *state.Store) []string {
+	var userIDs []string
+	for userID, preferences := range All(store) {
+		if preferences.DigestDM {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	sort.Strings(userIDs)
+	return userIDs
+}
+
+// AddFollow follows a colleague, replacing the label when they're already
+// followed.
+func AddFollow(store *state.Store, userID string, follow Follow) error {
+	preferences := Get(store, userID)
+	var following []Follow
+	for _, existing := range preferences.Following {
+		if !strings.EqualFold(existing.Email, follow.Email) {
+			following = append(following, existing)
+		}
+	}
+	preferences.Following = append(following, follow)
+	return Set(store, userID, preferences)
+}
+
+// RemoveFollow unfollows a colleague and reports whether they were followed.
+func RemoveFollow(store *state.Store, userID string, email string) (bool, error) {
+	preferences := Get(store, userID)
+	var following []Follow
+	for _, existing := range preferences.Following {
+		if !strings.EqualFold(existing.Email, email) {
+			following = append(following, existing)
+		}
+	}
+	if len(following) == len(preferences.Following) {
+		return false, nil
+	}
+	preferences.Following = following
+	return true, Set(store, userID, preferences)
+}
@@ -0,0 +1,111 @@
+package webhooks
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/justworks"
+	"github.com/jainmickey/justworks_integration/workcal"
+)
+
+const (
+	Created   = "pto.created"
+	Changed   = "pto.changed"
+	Cancelled = "pto.cancelled"
+	Started   = "pto.started"
+	Ended     = "pto.ended"
+)
+
+const dateLayout = "2006-01-02"
+
+// PTO is the leave an event is about. Events from the change snapshot only
+// have the UID, name, type, dates and emails.
+type PTO struct {
+	UID      string    `json:"uid"`
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	FirstDay string    `json:"first_day"`
+	LastDay  string    `json:"last_day"`
+	Partial  bool      `json:"partial"`
+	Hours    float64   `json:"hours_per_day"`
+	Emails   []string  `json:"emails"`
+}
+
+func toPTO(ev justworks.Event) PTO {
+	emails := ev.Emails()
+	if emails == nil {
+		emails = []string{}
+	}
+	return PTO{
+		UID:      ev.UID(),
+		Name:     ev.Name(),
+		Type:     ev.DisplayType(),
+		Start:    ev.StartDate(),
+		End:      ev.EndDate(),
+		FirstDay: ev.StartDate().Format(dateLayout),
+		LastDay:  ev.LastDay().Format(dateLayout),
+		Partial:  ev.IsPartialDay(),
+		Hours:    ev.HoursPerDay(),
+		Emails:   emails,
+	}
+}
+
+// Event is the JSON body of a webhook. ID is the same every time the same
+// thing happens, so receivers can drop repeats after retries.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	PTO       PTO       `json:"pto"`
+	Previous  *PTO      `json:"previous,omitempty"`
+}
+
+func NewEvent(eventType string, ev justworks.Event, previous *justworks.Event, now time.Time) Event {
+	event := Event{Type: eventType, CreatedAt: now.UTC(), PTO: toPTO(ev)}
+	if previous != nil {
+		previousPTO := toPTO(*previous)
+		event.Previous = &previousPTO
+	}
+	hash := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%s|%s|%s", eventType, event.PTO.UID, event.PTO.Name, event.PTO.Start.Format(time.RFC3339), event.PTO.End.Format(time.RFC3339))))
+	event.ID = hex.EncodeToString(hash[:])
+	return event
+}
+
+// Build makes the events for the changes since the last run, the PTO that
+// started after since up to today and the PTO that ended after since.
+// Remote work isn't PTO and is left out.
+func Build(changes justworks.Changes, events []justworks.Event, since time.Time, today time.Time, now time.Time) []Event {
+	var list []Event
+	for _, ev := range changes.New {
+		if ev.IsAbsence(true) {
+			list = append(list, NewEvent(Created, ev, nil, now))
+		}
+	}
+	for _, change := range changes.Moved {
+		if change.Current.IsAbsence(true) {
+			list = append(list, NewEvent(Changed, change.Current, &change.Previous, now))
+		}
+	}
+	for _, ev := range changes.Cancelled {
+		if ev.IsAbsence(true) {
+			list = append(list, NewEvent(Cancelled, ev, nil, now))
+		}
+	}
+	for _, ev := range events {
+		if !ev.IsAbsence(true) || ev.IsCancelled() || ev.IsTentative() {
+			continue
+		}
+		firstDay, lastDay := workcal.Day(ev.StartDate()), workcal.Day(ev.LastDay())
+		if firstDay.After(since) && !firstDay.After(today) {
+			list = append(list, NewEvent(Started, ev, nil, now))
+		}
+		if !lastDay.Before(since) && lastDay.Before(today) {
+			list = append(list, NewEvent(Ended, ev, nil, now))
+		}
+	}
+	return list
+}
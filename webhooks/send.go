@@ -0,0 +1,198 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/alert"
+	"github.com/jainmickey/justworks_integration/environment"
+	"github.com/jainmickey/justworks_integration/justworks"
+	"github.com/jainmickey/justworks_integration/state"
+	"github.com/jainmickey/justworks_integration/workcal"
+)
+
+const (
+	lastRunKey = "webhooks_last_run"
+	pendingKey = "webhooks_pending"
+)
+
+// maxRetrySleep is all the time one run may spend waiting between
+// attempts, so a dead endpoint can't run the Lambda out of time.
+const maxRetrySleep = 30 * time.Second
+
+// maxPendingAge is how long undelivered events are kept for the next runs.
+const maxPendingAge = 7 * 24 * time.Hour
+
+// Sign is the X-BootBot-Signature header: "t=<unix seconds>,v1=<hex
+// HMAC-SHA256 of "<t>.<body>" with the endpoint's secret>". Receivers
+// should recompute it and reject old timestamps.
+func Sign(secret string, body []byte, timestamp time.Time) string {
+	t := fmt.Sprintf("%d", timestamp.Unix())
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "." + string(body)))
+	return fmt.Sprintf("t=%s,v1=%s", t, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func wants(endpoint environment.WebhookEndpoint, eventType string) bool {
+	if len(endpoint.Events) == 0 {
+		return true
+	}
+	for _, wanted := range endpoint.Events {
+		if wanted == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// post makes one delivery attempt. Network errors, 429 and 5xx are worth
+// retrying, other responses aren't.
+func post(client *http.Client, endpoint environment.WebhookEndpoint, event Event, body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "BootBot-Webhooks")
+	req.Header.Set("X-BootBot-Event", event.Type)
+	req.Header.Set("X-BootBot-Delivery", event.ID)
+	req.Header.Set("X-BootBot-Signature", Sign(endpoint.Secret.Value(), body, time.Now()))
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("%s responded %s", endpoint.URL, resp.Status)
+	}
+	return false, nil
+}
+
+// Deliver posts event to endpoint, trying MaxAttempts times and waiting
+// InitialBackoffSeconds, then twice as long each time, with some jitter.
+// The waits come out of sleepLeft and stop when it runs out. It's signed
+// again on each attempt so the timestamp stays fresh. The bool says
+// whether it's worth trying again later.
+func Deliver(client *http.Client, endpoint environment.WebhookEndpoint, event Event, config environment.WebhooksConfig, sleepLeft *time.Duration) (bool, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return false, err
+	}
+	backoff := time.Duration(config.InitialBackoffSeconds) * time.Second
+	for attempt := 1; ; attempt++ {
+		retry, err := post(client, endpoint, event, body)
+		if err == nil {
+			return false, nil
+		}
+		wait := backoff + time.Duration(rand.Int63n(int64(backoff)/2+1))
+		if !retry || attempt >= config.MaxAttempts || wait > *sleepLeft {
+			return retry, fmt.Errorf("attempt %d: %s", attempt, err)
+		}
+		fmt.Println("Retrying webhook", endpoint.URL, event.Type, event.ID, err)
+		*sleepLeft -= wait
+		time.Sleep(wait)
+		backoff *= 2
+	}
+}
+
+// Send delivers the events waiting from earlier runs, then the new ones,
+// to each endpoint that wants them. Once an endpoint runs out of attempts
+// it's left alone for this run, and its undelivered events are kept in the
+// state store for the next one. Events an endpoint rejects are dropped.
+func Send(events []Event, config *environment.Config, store *state.Store, alerter alert.Alerter) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	sleepLeft := maxRetrySleep
+	pending := map[string][]Event{}
+	store.Get(pendingKey, &pending)
+	stillPending := map[string][]Event{}
+
+	for _, endpoint := range config.Webhooks.Endpoints {
+		var queue []Event
+		seen := map[string]bool{}
+		expired := 0
+		for _, event := range append(pending[endpoint.URL], events...) {
+			if seen[event.ID] || !wants(endpoint, event.Type) {
+				continue
+			}
+			seen[event.ID] = true
+			if time.Since(event.CreatedAt) > maxPendingAge {
+				expired++
+				continue
+			}
+			queue = append(queue, event)
+		}
+
+		var undelivered []Event
+		var problems []string
+		var downErr error
+		for _, event := range queue {
+			if downErr != nil {
+				undelivered = append(undelivered, event)
+				continue
+			}
+			retry, err := Deliver(client, endpoint, event, config.Webhooks, &sleepLeft)
+			if err == nil {
+				continue
+			}
+			fmt.Println("Error in delivering webhook", endpoint.URL, event.Type, event.ID, err)
+			if retry {
+				undelivered = append(undelivered, event)
+				downErr = err
+			} else {
+				problems = append(problems, fmt.Sprintf("%s %s %s was rejected: %s", event.Type, event.PTO.Name, event.PTO.FirstDay, err))
+			}
+		}
+		if len(undelivered) > 0 {
+			stillPending[endpoint.URL] = undelivered
+			problems = append(problems, fmt.Sprintf("%d events are waiting and will be tried again on the next run: %s", len(undelivered), downErr))
+		}
+		if expired > 0 {
+			problems = append(problems, fmt.Sprintf("%d events waited more than %d days and were dropped", expired, int(maxPendingAge.Hours()/24)))
+		}
+		if len(problems) > 0 {
+			alerter.Send(alert.Alert{
+				Key:         fmt.Sprintf("webhook-%s", endpoint.URL),
+				Severity:    alert.Warning,
+				Subject:     "Webhook deliveries failed",
+				Message:     fmt.Sprintf("Deliveries to %s failed:\n\n- %s", endpoint.URL, strings.Join(problems, "\n- ")),
+				Remediation: "Check the endpoint is up and accepts the signature.",
+			})
+		}
+	}
+	store.Set(pendingKey, stillPending)
+}
+
+// Emit sends the events since the last run: the calendar changes and the
+// PTO that started or ended. The first run only covers today, and a second
+// run on the same day only sends changes.
+func Emit(changes justworks.Changes, config *environment.Config, store *state.Store, alerter alert.Alerter) {
+	now := time.Now().UTC()
+	today := workcal.Day(now)
+	since := today.AddDate(0, 0, -1)
+	var lastRun time.Time
+	if store.Get(lastRunKey, &lastRun) {
+		since = workcal.Day(lastRun)
+	}
+
+	var events []justworks.Event
+	if since.Before(today) {
+		var err error
+		events, err = justworks.GetOverlapping(since, today.AddDate(0, 0, 1), config)
+		if err != nil {
+			fmt.Println("Error in reading events for webhooks", err)
+		}
+	}
+	webhookEvents := Build(changes, events, since, today, now)
+	fmt.Println("Sending", len(webhookEvents), "webhook events")
+	Send(webhookEvents, config, store, alerter)
+	store.Set(lastRunKey, today)
+}
@@ -0,0 +1,135 @@
+package workcal
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jainmickey/justworks_integration/holidays"
+)
+
+var weekdayNames = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// Calendar knows which days one person works: their weekly working days
+// plus their office's holidays.
+type Calendar struct {
+	workingDays map[time.Weekday]bool
+	office      string
+	holidays    *holidays.Calendar
+}
+
+// Day is midnight at the start of t's date, in t's location.
+func Day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func New(workingDays map[string]bool, office string, holidaysCalendar *holidays.Calendar) Calendar {
+	days := map[time.Weekday]bool{}
+	for name, working := range workingDays {
+		if weekday, ok := weekdayNames[strings.ToLower(name)]; ok && working {
+			days[weekday] = true
+		}
+	}
+	// ---- Forecast leaves working_days empty for some people, assume Mon-Fri ----
+	if len(days) == 0 {
+		for weekday := time.Monday; weekday <= time.Friday; weekday++ {
+			days[weekday] = true
+		}
+	}
+	return Calendar{workingDays: days, office: office, holidays: holidaysCalendar}
+}
+
+// Default is a Monday to Friday week with the office's holidays.
+func Default(office string, holidaysCalendar *holidays.Calendar) Calendar {
+	return New(nil, office, holidaysCalendar)
+}
+
+func (c Calendar) IsHoliday(date time.Time) bool {
+	_, ok := c.holidays.IsHoliday(c.office, date)
+	return ok
+}
+
+func (c Calendar) IsWorkingDay(date time.Time) bool {
+	return c.workingDays[date.Weekday()] && !c.IsHoliday(date)
+}
+
+// BusinessDays counts the working days from first to last, both included.
+func (c Calendar) BusinessDays(first time.Time, last time.Time) int {
+	count := 0
+	for date := Day(first); !date.After(last); date = date.AddDate(0, 0, 1) {
+		if c.IsWorkingDay(date) {
+			count++
+		}
+	}
+	return count
+}
+
+// NextWorkingDay is the first working day after date.
+func (c Calendar) NextWorkingDay(date time.Time) time.Time {
+	next := Day(date).AddDate(0, 0, 1)
+	for i := 0; i < 366 && !c.IsWorkingDay(next); i++ {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// PreviousWorkingDay is the last working day before date.
+func (c Calendar) PreviousWorkingDay(date time.Time) time.Time {
+	previous := Day(date).AddDate(0, 0, -1)
+	for i := 0; i < 366 && !c.IsWorkingDay(previous); i++ {
+		previous = previous.AddDate(0, 0, -1)
+	}
+	return previous
+}
+
+// BookingRanges splits first..last (both included) at holidays and trims
+// every piece to start and end on a working day. Weekly days off inside a
+// piece are kept, Forecast skips those by itself.
+func (c Calendar) BookingRanges(first time.Time, last time.Time) [][2]time.Time {
+	var ranges [][2]time.Time
+	var rangeStart, rangeEnd time.Time
+	open := false
+	for date := Day(first); !date.After(last); date = date.AddDate(0, 0, 1) {
+		if c.IsHoliday(date) {
+			if open {
+				ranges = append(ranges, [2]time.Time{rangeStart, rangeEnd})
+				open = false
+			}
+			continue
+		}
+		if !c.IsWorkingDay(date) {
+			continue
+		}
+		if !open {
+			rangeStart = date
+			open = true
+		}
+		rangeEnd = date
+	}
+	if open {
+		ranges = append(ranges, [2]time.Time{rangeStart, rangeEnd})
+	}
+	return ranges
+}
+
+// ReturnPhrase says when someone whose last day off is lastDay is back,
+// e.g. "back tomorrow" or "back Monday". The weekday is only used while it
+// can't be mistaken for a later week.
+func (c Calendar) ReturnPhrase(lastDay time.Time, today time.Time) string {
+	back := c.NextWorkingDay(lastDay)
+	if back.Equal(Day(today).AddDate(0, 0, 1)) {
+		return "back tomorrow"
+	}
+	if back.Sub(Day(lastDay)) < 7*24*time.Hour && back.Sub(Day(today)) < 7*24*time.Hour {
+		return fmt.Sprintf("back %s", back.Format("Monday"))
+	}
+	return fmt.Sprintf("back %s", back.Format("Mon, 2 January"))
+}